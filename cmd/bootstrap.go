@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"github.com/jackzampolin/cosmos-registrar/pkg/node"
+	"github.com/spf13/cobra"
+)
+
+func bootstrapCmd() *cobra.Command {
+	var (
+		home string
+		opts = node.DefaultBootstrapOptions()
+	)
+	cmd := &cobra.Command{
+		Use:   "bootstrap CHAIN_ID --home DIR",
+		Short: "initialize a node home directory with the registry data of a chain",
+		Long: `Writes the registered genesis.json of a chain, verified against its
+checksum, to the config folder of an existing tendermint home directory,
+sets the seeds and persistent_peers from the registered peers and configures
+state sync from the latest light root.
+
+A genesis.json that does not match the registered one is not overwritten
+unless --force is given.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			_, registryFolder := openRegistryRoot()
+			if err = node.Bootstrap(registryFolder, args[0], home, opts, logger); err != nil {
+				return
+			}
+			logger.Info("node home initialized", "chainID", args[0], "home", home)
+			return
+		},
+	}
+	cmd.Flags().StringVar(&home, "home", "", "tendermint home directory of the node")
+	cmd.Flags().BoolVar(&opts.Force, "force", false, "overwrite a genesis.json that does not match the registered one")
+	cmd.Flags().IntVar(&opts.RPCServers, "rpc-servers", opts.RPCServers, "number of state sync rpc servers to pick from the peers")
+	cmd.Flags().IntVar(&opts.MaxPeers, "max-peers", opts.MaxPeers, "maximum number of persistent peers")
+	cmd.MarkFlagRequired("home")
+	return cmd
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jackzampolin/cosmos-registrar/pkg/gitwrap"
+	"github.com/jackzampolin/cosmos-registrar/pkg/node"
+	"github.com/jackzampolin/cosmos-registrar/pkg/utils"
+	"github.com/noandrea/go-codeowners"
+	"github.com/spf13/cobra"
+)
+
+func checkpointsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "checkpoints",
+		Short: "manage the checkpoints of the chains you own",
+	}
+	cmd.AddCommand(
+		checkpointsAddCmd(),
+	)
+	return cmd
+}
+
+func checkpointsAddCmd() *cobra.Command {
+	var cp node.Checkpoint
+	cmd := &cobra.Command{
+		Use:   "add CHAIN_ID HEIGHT",
+		Short: "pin the block of a chain at a height",
+		Long: `Adds a checkpoint to the checkpoints.json of a chain you own, then commits
+and pushes it to the registry. Peers that report a different block at a
+checkpoint height are flagged as forked and excluded from the updates.
+
+The hashes of the block are asked to the registered peers, that must agree
+on them according to the configured quorum, unless they are given with
+--app-hash and --block-hash.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			chainID := args[0]
+			if cp.Height, err = strconv.ParseInt(args[1], 10, 64); err != nil {
+				return fmt.Errorf("invalid height %s: %s", args[1], err)
+			}
+
+			repo, registryFolder := openRegistryRoot()
+			co, err := codeowners.FromFile(registryFolder)
+			utils.AbortIfError(err, "cannot find the CODEOWNERS file: %v", err)
+			owned := myChains(co, config)
+			if !utils.ContainsStr(&owned, chainID) {
+				return fmt.Errorf("you are not an owner of chain %s", chainID)
+			}
+
+			if cp.AppHash == "" && cp.BlockHash == "" {
+				if cp, err = fetchCheckpoint(cmd.Context(), registryFolder, chainID, cp.Height); err != nil {
+					return
+				}
+			}
+			cps, err := node.LoadCheckpoints(registryFolder, chainID)
+			if err != nil {
+				return fmt.Errorf("loading checkpoints: %s", err)
+			}
+			if cps, err = cps.Add(cp); err != nil {
+				return
+			}
+			if err = node.SaveCheckpoints(registryFolder, chainID, cps); err != nil {
+				return fmt.Errorf("saving checkpoints: %s", err)
+			}
+			logger.Info("checkpoint added", "chainID", chainID, "height", cp.Height, "app-hash", cp.AppHash, "block-hash", cp.BlockHash)
+
+			if err = gitwrap.StageToCommit(repo, chainID); err != nil {
+				return fmt.Errorf("staging %s: %s", chainID, err)
+			}
+			hash, err := gitwrap.CommitAndPush(repo,
+				config.GitName,
+				config.GitEmail,
+				fmt.Sprintf("add checkpoint at height %d for chain id %s", cp.Height, chainID),
+				time.Now(),
+				config.BasicAuth(),
+			)
+			utils.AbortIfError(err, "failed to update registry, please manually rollback the repo changes and try again")
+			logger.Info("checkpoint committed", "chainID", chainID, "commitHash", hash)
+			return
+		},
+	}
+	cmd.Flags().StringVar(&cp.AppHash, "app-hash", "", "app hash of the block, in hex")
+	cmd.Flags().StringVar(&cp.BlockHash, "block-hash", "", "hash of the block, in hex")
+	return cmd
+}
+
+// fetchCheckpoint asks the registered peers of a chain for the block at
+// height h
+func fetchCheckpoint(ctx context.Context, registryFolder, chainID string, h int64) (cp node.Checkpoint, err error) {
+	peers, err := node.LoadPeers(registryFolder, chainID, config.RPCAddr, logger)
+	if err != nil {
+		return cp, fmt.Errorf("loading peers: %s", err)
+	}
+	policy, err := node.NewAgreementPolicy(config.Quorum, config.QuorumMinPeers)
+	if err != nil {
+		return cp, fmt.Errorf("invalid light root agreement policy: %s", err)
+	}
+	sched := node.NewScheduler(node.SchedulerOptions{
+		Concurrency:    config.MaxConcurrency,
+		RequestTimeout: config.RequestTimeout,
+		Deadline:       config.RunDeadline,
+	})
+	ctx, cancel := sched.WithDeadline(ctx)
+	defer cancel()
+	return node.FetchCheckpoint(ctx, sched, peers, h, policy, logger)
+}
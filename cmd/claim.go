@@ -42,12 +42,19 @@ var claimCmd = &cobra.Command{
 	Use:   "claim RPC_ADDRESS",
 	Short: "Claim a name for a cosmos based chain",
 	Long: `This command allows you to submit a claim request for
-a name for your chain.`,
+a name for your chain.
+
+For chains whose genesis cannot be downloaded from the node use
+--genesis-file to provide it, plain or gzipped. The file is verified
+against the node before being registered.`,
 	Run:  claim,
 	Args: cobra.ExactArgs(1),
 }
 
+var claimGenesisFile string
+
 func init() {
+	claimCmd.Flags().StringVar(&claimGenesisFile, "genesis-file", "", "read the genesis from this file instead of downloading it from the node")
 	rootCmd.AddCommand(claimCmd)
 }
 
@@ -62,6 +69,9 @@ func claim(cmd *cobra.Command, args []string) {
 	)
 
 	utils.AbortIfError(err, "error fetching the chain ID: %v", err)
+	// the chain ID becomes a folder and a CODEOWNERS pattern
+	_, err = node.ParseChainID(claimName)
+	utils.AbortIfError(err, "the chain ID cannot be registered: %v", err)
 
 	// check if root url is valid
 	_, err = url.Parse(config.RegistryRoot)
@@ -105,13 +115,12 @@ func claim(cmd *cobra.Command, args []string) {
 	utils.AbortCleanupIfError(err, forkRepoFolder, "cannot create branch: %v", err)
 
 	// fetch the chain data
-	err = node.DumpInfo(forkRepoFolder, claimName, rpcAddress, logger)
+	err = node.DumpInfo(forkRepoFolder, claimName, rpcAddress, claimGenesisFile, config.BuildInfo(), logger)
 	println("fetching chain data")
 	utils.AbortCleanupIfError(err, forkRepoFolder, fmt.Sprintf("error connecting to the node at %s: %v", rpcAddress, err), err)
 
 	println("starting claiming process for", claimName)
 	// add rule to the codeowner
-	// TODO: ensure that the chain id is compliant to CAIP-2
 	err = co.AddPattern(fmt.Sprintf("/%s/", claimName), []string{fmt.Sprint("@", config.GitName)})
 	utils.AbortIfError(err, "invalid claim name folder: %v", err)
 	coFile := path.Join(forkRepoFolder, codeownersFile)
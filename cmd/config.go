@@ -7,6 +7,7 @@ import (
 
 	registrar "github.com/jackzampolin/cosmos-registrar/pkg/config"
 	"github.com/jackzampolin/cosmos-registrar/pkg/gitwrap"
+	"github.com/jackzampolin/cosmos-registrar/pkg/node"
 	"github.com/jackzampolin/cosmos-registrar/pkg/prompts"
 	"github.com/spf13/afero"
 	"github.com/spf13/cobra"
@@ -32,6 +33,17 @@ func init() {
 	viper.SetDefault("registry-root-branch", "main")
 	viper.SetDefault("git-name", "Your name goes here")
 	viper.SetDefault("git-email", "your@email.here")
+	viper.SetDefault("crawl-depth", node.DefaultCrawlOptions().MaxDepth)
+	viper.SetDefault("crawl-max-peers", node.DefaultCrawlOptions().MaxPeers)
+	viper.SetDefault("peer-max-failures", node.DefaultPeerStoreOptions().MaxFailures)
+	viper.SetDefault("verify-peer-ids", false)
+	viper.SetDefault("peer-max-lag", node.DefaultClassifyOptions().MaxLag)
+	viper.SetDefault("max-concurrency", node.DefaultSchedulerOptions().Concurrency)
+	viper.SetDefault("request-timeout", node.DefaultSchedulerOptions().RequestTimeout)
+	viper.SetDefault("run-deadline", node.DefaultSchedulerOptions().Deadline)
+	viper.SetDefault("quorum", fmt.Sprintf("%d/%d", node.DefaultAgreementPolicy().Numerator, node.DefaultAgreementPolicy().Denominator))
+	viper.SetDefault("quorum-min-peers", node.DefaultAgreementPolicy().MinPeers)
+	viper.SetDefault("trusting-period", node.DefaultLightRootOptions().TrustingPeriod)
 	// viper.SetDefault("commit-message", "update roots of trust")
 }
 
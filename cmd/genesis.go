@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/jackzampolin/cosmos-registrar/pkg/node"
+	"github.com/spf13/cobra"
+)
+
+func genesisCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "genesis",
+		Short: "work with the genesis files in the registry",
+	}
+	cmd.AddCommand(
+		genesisVerifyCmd(),
+	)
+	return cmd
+}
+
+func genesisVerifyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "verify CHAIN_ID PATH",
+		Short: "verify that a local genesis.json is the one registered for a chain",
+		Long: `Canonicalizes the genesis.json at PATH the same way the registry does
+when a chain is claimed, then compares its sha256 with genesis.json.sum.
+When they differ the top-level sections that don't match are listed.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			chainID, pth := args[0], args[1]
+			_, registryFolder := openRegistryRoot()
+			v, err := node.VerifyGenesis(registryFolder, chainID, pth)
+			if err != nil {
+				return
+			}
+			if v.Match() {
+				fmt.Printf("%s matches the genesis registered for %s (sha256 %s)\n", pth, chainID, v.Sum)
+				return
+			}
+			fmt.Printf("%s does not match the genesis registered for %s\n", pth, chainID)
+			fmt.Printf("  sha256 %s, expected %s\n", v.Sum, v.Expected)
+			for _, d := range v.Diff {
+				fmt.Printf("  %s:\n    local:      %s\n    registered: %s\n", d.Key, d.Local, d.Registered)
+			}
+			return fmt.Errorf("genesis verification failed")
+		},
+	}
+}
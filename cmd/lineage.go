@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackzampolin/cosmos-registrar/pkg/gitwrap"
+	"github.com/jackzampolin/cosmos-registrar/pkg/node"
+	"github.com/jackzampolin/cosmos-registrar/pkg/utils"
+	"github.com/noandrea/go-codeowners"
+	"github.com/spf13/cobra"
+)
+
+func lineageCmd() *cobra.Command {
+	var u node.Upgrade
+	cmd := &cobra.Command{
+		Use:   "lineage PREDECESSOR SUCCESSOR",
+		Short: "record that a chain continues another one after an upgrade",
+		Long: `Links two chains of the registry, typically two revisions of a chain like
+cosmoshub-3 and cosmoshub-4, that were separated by a genesis export upgrade.
+The link is written to the lineage.json of both chains, then committed and
+pushed to the registry.
+
+Both chains must be in the registry and owned by the same CODEOWNERS entry,
+that must include you.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			u.Predecessor, u.Successor = args[0], args[1]
+
+			repo, registryFolder := openRegistryRoot()
+			co, err := codeowners.FromFile(registryFolder)
+			utils.AbortIfError(err, "cannot find the CODEOWNERS file: %v", err)
+			owned := myChains(co, config)
+			for _, chainID := range args {
+				if !utils.ContainsStr(&owned, chainID) {
+					return fmt.Errorf("you are not an owner of chain %s", chainID)
+				}
+			}
+			if err = sameOwners(co, u.Predecessor, u.Successor); err != nil {
+				return
+			}
+
+			if err = node.LinkChains(registryFolder, u, logger); err != nil {
+				return fmt.Errorf("linking %s to %s: %s", u.Successor, u.Predecessor, err)
+			}
+			logger.Info("chains linked", "predecessor", u.Predecessor, "successor", u.Successor, "halt-height", u.HaltHeight, "upgrade", u.Name)
+
+			for _, chainID := range args {
+				if err = gitwrap.StageToCommit(repo, chainID); err != nil {
+					return fmt.Errorf("staging %s: %s", chainID, err)
+				}
+			}
+			hash, err := gitwrap.CommitAndPush(repo,
+				config.GitName,
+				config.GitEmail,
+				fmt.Sprintf("link chain id %s to its predecessor %s", u.Successor, u.Predecessor),
+				time.Now(),
+				config.BasicAuth(),
+			)
+			utils.AbortIfError(err, "failed to update registry, please manually rollback the repo changes and try again")
+			logger.Info("lineage committed", "predecessor", u.Predecessor, "successor", u.Successor, "commitHash", hash)
+			return
+		},
+	}
+	cmd.Flags().Int64Var(&u.HaltHeight, "halt-height", 0, "height the predecessor chain halted at")
+	cmd.Flags().StringVar(&u.Name, "upgrade-name", "", "name of the upgrade")
+	cmd.MarkFlagRequired("halt-height")
+	return cmd
+}
+
+// sameOwners checks that two chains are owned by the same CODEOWNERS entry
+func sameOwners(co *codeowners.Codeowners, a, b string) error {
+	ownersOf := func(chainID string) (string, error) {
+		owners := co.LocalOwners(fmt.Sprintf("/%s/", chainID))
+		if len(owners) == 0 {
+			return "", fmt.Errorf("chain %s has no CODEOWNERS entry", chainID)
+		}
+		owners = append([]string{}, owners...)
+		sort.Strings(owners)
+		return strings.Join(owners, " "), nil
+	}
+	oa, err := ownersOf(a)
+	if err != nil {
+		return err
+	}
+	ob, err := ownersOf(b)
+	if err != nil {
+		return err
+	}
+	if oa != ob {
+		return fmt.Errorf("chains %s and %s have different owners: %s and %s", a, b, oa, ob)
+	}
+	return nil
+}
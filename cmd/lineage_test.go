@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/noandrea/go-codeowners"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSameOwners(t *testing.T) {
+	co, err := codeowners.FromReader(strings.NewReader(testCO+"/cosmoshub-2/             @jackzampolin\n/akashnet-2/              @okwme @jackzampolin\n"), "/test/reporoot")
+	assert.Nil(t, err)
+
+	assert.Nil(t, sameOwners(co, "cosmoshub-2", "cosmoshub-3"))
+	assert.NotNil(t, sameOwners(co, "cosmoshub-3", "cosmoshub-4"))
+	assert.NotNil(t, sameOwners(co, "akashnet-1", "akashnet-2"))
+	// only the global entry matches
+	assert.NotNil(t, sameOwners(co, "cosmoshub-4", "cosmoshub-5"))
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/jackzampolin/cosmos-registrar/pkg/node"
+	"github.com/spf13/cobra"
+)
+
+func peersCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "peers",
+		Short: "use the registered peers of a chain",
+	}
+	cmd.AddCommand(
+		peersExportCmd(),
+	)
+	return cmd
+}
+
+func peersExportCmd() *cobra.Command {
+	var (
+		format   string
+		maxPeers int
+	)
+	cmd := &cobra.Command{
+		Use:   "export CHAIN_ID",
+		Short: "print the p2p addresses of the registered peers of a chain",
+		Long: `Prints the p2p addresses of the registered peers of a chain as the comma
+separated id@host:port list used by the seeds and persistent_peers settings
+of the tendermint configuration.
+
+With --format seeds the seeds are printed, with --format persistent-peers the
+best peers that are not seeds, up to --max-peers. Peers whose p2p port did not
+accept connections at the last update are left out.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			_, registryFolder := openRegistryRoot()
+			out, err := node.ExportPeers(registryFolder, args[0], format, maxPeers)
+			if err != nil {
+				return
+			}
+			fmt.Println(out)
+			return
+		},
+	}
+	cmd.Flags().StringVar(&format, "format", node.ExportPersistentPeers, fmt.Sprintf("export format, %s or %s", node.ExportPersistentPeers, node.ExportSeeds))
+	cmd.Flags().IntVar(&maxPeers, "max-peers", node.DefaultBootstrapOptions().MaxPeers, "maximum number of persistent peers")
+	return cmd
+}
@@ -48,6 +48,13 @@ func init() {
 	rootCmd.AddCommand(
 		configCmd(),
 		updateCmd,
+		rootsCmd(),
+		checkpointsCmd(),
+		lineageCmd(),
+		statesyncCmd(),
+		peersCmd(),
+		bootstrapCmd(),
+		genesisCmd(),
 		getVersionCmd(),
 	)
 }
@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jackzampolin/cosmos-registrar/pkg/gitwrap"
+	"github.com/jackzampolin/cosmos-registrar/pkg/node"
+	"github.com/jackzampolin/cosmos-registrar/pkg/utils"
+	"github.com/noandrea/go-codeowners"
+	"github.com/spf13/cobra"
+)
+
+func rootsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "roots",
+		Short: "manage the light roots of the chains you own",
+	}
+	cmd.AddCommand(
+		rootsPruneCmd(),
+		rootsRetentionCmd(),
+	)
+	return cmd
+}
+
+func rootsPruneCmd() *cobra.Command {
+	var dryRun bool
+	cmd := &cobra.Command{
+		Use:   "prune [CHAIN_ID...]",
+		Short: "apply the retention policy to the light roots history",
+		Long: `Removes the light roots that the retention policy of each chain does not
+keep from the history of the given chains, or of all the chains you own,
+then commits and pushes the changes to the registry.`,
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			repo, registryFolder := openRegistryRoot()
+			co, err := codeowners.FromFile(registryFolder)
+			utils.AbortIfError(err, "cannot find the CODEOWNERS file: %v", err)
+			owned := myChains(co, config)
+			chainIDs := args
+			if len(chainIDs) == 0 {
+				chainIDs = owned
+			}
+
+			committed := 0
+			for _, chainID := range chainIDs {
+				if !utils.ContainsStr(&owned, chainID) {
+					return fmt.Errorf("you are not an owner of chain %s", chainID)
+				}
+				policy, err := node.LoadRetentionPolicy(registryFolder, chainID)
+				if err != nil {
+					return fmt.Errorf("loading the retention policy of %s: %s", chainID, err)
+				}
+				if policy.IsZero() {
+					logger.Info("the retention policy keeps every light root, nothing to prune", "chainID", chainID)
+					continue
+				}
+				removed, err := node.PruneLightRoots(registryFolder, chainID, policy, dryRun, logger)
+				if err != nil {
+					return fmt.Errorf("pruning light roots of %s: %s", chainID, err)
+				}
+				logger.Info("light roots pruned", "chainID", chainID, "removed", len(removed), "policy", policy, "dry-run", dryRun)
+				if dryRun {
+					for _, lr := range removed {
+						fmt.Printf("%s\t%d\t%s\n", chainID, lr.TrustHeight, lr.TrustHash)
+					}
+					continue
+				}
+				if len(removed) == 0 {
+					continue
+				}
+				if err = gitwrap.StageToCommit(repo, chainID); err != nil {
+					return fmt.Errorf("staging %s: %s", chainID, err)
+				}
+				hash, err := gitwrap.Commit(repo,
+					config.GitName,
+					config.GitEmail,
+					fmt.Sprintf("prune light roots for chain id %s", chainID),
+					time.Now(),
+				)
+				if err != nil {
+					return fmt.Errorf("committing %s: %s", chainID, err)
+				}
+				logger.Info("chain ID prune committed", "chainID", chainID, "commitHash", hash)
+				committed++
+			}
+			if committed == 0 {
+				return nil
+			}
+			err = gitwrap.Push(repo, config.BasicAuth())
+			utils.AbortIfError(err, "failed to update registry, please manually rollback the repo changes and try again")
+			return
+		},
+	}
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "only print the light roots that would be removed")
+	return cmd
+}
+
+func rootsRetentionCmd() *cobra.Command {
+	policy := node.DefaultRetentionPolicy()
+	cmd := &cobra.Command{
+		Use:   "retention CHAIN_ID",
+		Short: "set the retention policy of the light roots of a chain",
+		Long: `Writes the retention policy of the light roots history of a chain you own
+to its light-roots/retention.json, then commits and pushes it to the
+registry. Every registrar updating the chain applies this policy, chains
+without a retention file use the default one. Set all the rules to 0 to keep
+every light root.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			chainID := args[0]
+			repo, registryFolder := openRegistryRoot()
+			co, err := codeowners.FromFile(registryFolder)
+			utils.AbortIfError(err, "cannot find the CODEOWNERS file: %v", err)
+			owned := myChains(co, config)
+			if !utils.ContainsStr(&owned, chainID) {
+				return fmt.Errorf("you are not an owner of chain %s", chainID)
+			}
+
+			if err = node.SaveRetentionPolicy(registryFolder, chainID, policy); err != nil {
+				return fmt.Errorf("saving the retention policy: %s", err)
+			}
+			logger.Info("retention policy set", "chainID", chainID, "policy", policy)
+
+			if err = gitwrap.StageToCommit(repo, chainID); err != nil {
+				return fmt.Errorf("staging %s: %s", chainID, err)
+			}
+			hash, err := gitwrap.CommitAndPush(repo,
+				config.GitName,
+				config.GitEmail,
+				fmt.Sprintf("set light roots retention policy for chain id %s", chainID),
+				time.Now(),
+				config.BasicAuth(),
+			)
+			utils.AbortIfError(err, "failed to update registry, please manually rollback the repo changes and try again")
+			logger.Info("retention policy committed", "chainID", chainID, "commitHash", hash)
+			return
+		},
+	}
+	cmd.Flags().IntVar(&policy.KeepLast, "keep-last", policy.KeepLast, "number of most recent light roots kept")
+	cmd.Flags().IntVar(&policy.KeepDaily, "keep-daily", policy.KeepDaily, "number of days for which the last light root of the day is kept")
+	cmd.Flags().IntVar(&policy.KeepWeekly, "keep-weekly", policy.KeepWeekly, "number of weeks for which the last light root of the week is kept")
+	return cmd
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/jackzampolin/cosmos-registrar/pkg/node"
+	"github.com/jackzampolin/cosmos-registrar/pkg/tmconfig"
+	"github.com/spf13/cobra"
+)
+
+func statesyncCmd() *cobra.Command {
+	var (
+		tomlPath string
+		servers  int
+	)
+	cmd := &cobra.Command{
+		Use:   "statesync CHAIN_ID",
+		Short: "print the [statesync] configuration of a chain from the registry",
+		Long: `Builds the [statesync] section of the tendermint config.toml from the
+registry data of a chain: the latest light root is used as root of trust,
+the rpc servers are the best reachable peers and the trust period is two
+thirds of the unbonding time in the genesis.
+
+The section is printed, or patched into the config.toml given with --toml.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			_, registryFolder := openRegistryRoot()
+			ss, err := node.NewStateSync(registryFolder, args[0], servers, logger)
+			if err != nil {
+				return
+			}
+			if tomlPath == "" {
+				fmt.Print(ss)
+				return
+			}
+			if err = tmconfig.PatchFile(tomlPath, "statesync", ss.Values()); err != nil {
+				return
+			}
+			logger.Info("state sync configured", "chainID", args[0], "config", tomlPath, "trust-height", ss.TrustHeight)
+			return
+		},
+	}
+	cmd.Flags().StringVar(&tomlPath, "toml", "", "patch the [statesync] section of this config.toml instead of printing it")
+	cmd.Flags().IntVar(&servers, "rpc-servers", node.DefaultStateSyncServers, "number of rpc servers to pick from the peers")
+	return cmd
+}
@@ -1,11 +1,16 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/url"
+	"os"
+	"os/signal"
 	"path"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/go-git/go-git/v5"
@@ -18,8 +23,10 @@ import (
 )
 
 type updates struct {
-	lr    *node.LightRoot
-	peers map[string]*node.Peer
+	// lr is nil when the peers did not agree on a new light root
+	lr       *node.LightRoot
+	peers    *node.PeerStore
+	versions []node.NodeVersion
 }
 
 // updateCmd represents the update command
@@ -29,30 +36,46 @@ var updateCmd = &cobra.Command{
 	RunE:  update,
 }
 
+var updateReanchor []string
+
+func init() {
+	updateCmd.Flags().StringSliceVar(&updateReanchor, "reanchor", nil, "chain IDs whose expired light root is replaced by one accepted on the agreement of the peers alone")
+}
+
 func update(cmd *cobra.Command, args []string) (err error) {
 
 	var (
-		repo           *git.Repository
-		registryFolder = path.Join(config.Workspace, "registry-root")
-		mu             sync.Mutex
-		updatedInfo    = make(map[string]*updates)
+		mu          sync.Mutex
+		updatedInfo = make(map[string]*updates)
 	)
 
-	// open/clone and pull changes from the root repo
-	_, err = url.Parse(config.RegistryRoot)
-	utils.AbortIfError(err, "the registry root url is not a valid url: %s", config.RegistryRoot)
-
-	repo, err = gitwrap.CloneOrOpen(config.RegistryRoot, registryFolder, config.BasicAuth())
-	utils.AbortIfError(err, "aborted due to an error cloning registry fork repo: %v", err)
-
-	err = gitwrap.PullBranch(repo, config.RegistryRootBranch)
-	utils.AbortIfError(err, "error pulling changes for the %s branch: %v", config.RegistryRootBranch, err)
+	repo, registryFolder := openRegistryRoot()
 
 	// build a list of the chainIDs that the user owns
 	co, err := codeowners.FromFile(registryFolder)
 	utils.AbortIfError(err, "cannot find the CODEOWNERS file: %v", err)
 	chainIDs := myChains(co, config)
 
+	policy, err := node.NewAgreementPolicy(config.Quorum, config.QuorumMinPeers)
+	utils.AbortIfError(err, "invalid light root agreement policy: %v", err)
+	lrOpts := node.DefaultLightRootOptions()
+	lrOpts.Agreement = policy
+	if config.TrustingPeriod > 0 {
+		lrOpts.TrustingPeriod = config.TrustingPeriod
+	}
+
+	// all the requests to the chains' nodes share the same scheduler, the run
+	// stops when the deadline expires or on interrupt
+	sched := node.NewScheduler(node.SchedulerOptions{
+		Concurrency:    config.MaxConcurrency,
+		RequestTimeout: config.RequestTimeout,
+		Deadline:       config.RunDeadline,
+	})
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := sched.WithDeadline(ctx)
+	defer cancel()
+
 	// update is meant to be called mostly by a CODEOWNER who owns the entire
 	// repo. So one machine will contact all the chainIDs and push all the
 	// updates. Contacting the chainIDs are done asynchronously
@@ -61,42 +84,105 @@ func update(cmd *cobra.Command, args []string) (err error) {
 		wg.Add(1)
 		go func(rootFolder, chainID string) {
 			defer wg.Done()
-			peers, err := node.LoadPeers(rootFolder, chainID, config.RPCAddr, logger)
+			peers, err := node.LoadPeerStore(rootFolder, chainID, peerStoreOptions(), logger)
 			if err != nil {
 				logger.Error("failed to load peer info", "chainID", chainID, "err", err)
 				return
 			}
 
+			cps, err := node.LoadCheckpoints(rootFolder, chainID)
+			if err != nil {
+				logger.Error("failed to load checkpoints", "chainID", chainID, "err", err)
+				return
+			}
 			// contact all peers, ask them for peers and check if those are up
-			peersReachable := node.RefreshPeers(peers, logger)
-			// ask reachable peers about light root hashes
-			lr, err := node.UpdateLightRoots(chainID, peersReachable, logger)
+			peersReachable, contacted := node.RefreshPeers(ctx, sched, peers.Peers(), node.CrawlOptions{
+				MaxDepth:       config.CrawlDepth,
+				MaxPeers:       config.CrawlMaxPeers,
+				Checkpoints:    cps,
+				VerifyIdentity: config.VerifyPeerIDs,
+			}, logger)
+			// the last published light root is the root of trust for the new one
+			var trusted *node.LightRoot
+			lrh, err := node.LoadLightRoots(rootFolder, chainID)
 			if err != nil {
-				logger.Error("failed to update lightroots", "chainID", chainID, "err", err)
+				logger.Error("failed to load lightroots", "chainID", chainID, "err", err)
 				return
 			}
-
-			u := &updates{
-				lr:    lr,
-				peers: peersReachable,
+			if len(lrh) > 0 {
+				trusted = &lrh[len(lrh)-1]
+			}
+			// ask reachable peers about light root hashes
+			chainOpts := lrOpts
+			chainOpts.Checkpoints = cps
+			chainOpts.Reanchor = utils.ContainsStr(&updateReanchor, chainID)
+			lr, dissenters, lrErr := node.UpdateLightRoots(ctx, sched, chainID, peersReachable, trusted, chainOpts, logger)
+			if lrErr != nil {
+				logger.Error("failed to update lightroots", "chainID", chainID, "err", lrErr)
+				if errors.Is(lrErr, node.ErrTrustExpired) {
+					logger.Error("the last light root is older than the trusting period, run update with --reanchor to accept a new one on the agreement of the peers alone", "chainID", chainID)
+				}
 			}
+			// the known peers are kept until they fail too many updates in a
+			// row, the crawl is merged even when no light root was agreed on
+			if evicted := peers.Merge(peersReachable, contacted, time.Now()); len(evicted) > 0 {
+				logger.Info("evicted unreachable peers", "chainID", chainID, "peers", strings.Join(evicted, ","))
+			}
+			u := &updates{peers: peers}
+			if lrErr == nil {
+				// peers that disagree with the majority are not published
+				peers.Remove(dissenters...)
+				for _, id := range dissenters {
+					delete(peersReachable, id)
+				}
+				u.lr = lr
+				u.versions = node.FetchNodeVersions(ctx, sched, peersReachable, logger)
+			}
+			peers.Classify(classifyOptions(rootFolder, chainID))
 			mu.Lock()
 			updatedInfo[chainID] = u
 			mu.Unlock()
 		}(registryFolder, cID)
 	}
 	wg.Wait()
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return fmt.Errorf("update interrupted, no changes were saved")
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		logger.Error("update deadline expired, saving the chains that completed", "deadline", config.RunDeadline)
+	}
 
 	// saving and committing the info is done synchronously.
 	for chainID, u := range updatedInfo {
-		// save the updated lightroot history
-		err = node.SaveLightRoots(registryFolder, chainID, u.lr, logger)
-		if err != nil {
-			logger.Error("failed to save updated lightroots", "chainID", chainID, "err", err)
+		// save the updated peerlist
+		if err = u.peers.Save(registryFolder, chainID, logger); err != nil {
+			logger.Error("failed to save peers", "chainID", chainID, "err", err)
 			return
 		}
-		// save the updated peerlist
-		node.SavePeers(registryFolder, chainID, u.peers, logger)
+		// pin the seed checkpoints of the chains registered before them
+		if _, err = node.SeedCheckpoints(registryFolder, chainID); err != nil {
+			logger.Error("failed to seed checkpoints", "chainID", chainID, "err", err)
+			return
+		}
+		// the chains the peers did not agree on only get their peers updated
+		if u.lr != nil {
+			// save the updated lightroot history
+			var policy node.RetentionPolicy
+			if policy, err = node.LoadRetentionPolicy(registryFolder, chainID); err != nil {
+				logger.Error("failed to load the light roots retention policy", "chainID", chainID, "err", err)
+				return
+			}
+			err = node.SaveLightRoots(registryFolder, chainID, u.lr, policy, logger)
+			if err != nil {
+				logger.Error("failed to save updated lightroots", "chainID", chainID, "err", err)
+				return
+			}
+			// record the software run by the peers
+			if err = node.UpdateBinaries(registryFolder, chainID, nil, u.versions, u.lr.TrustHeight, logger); err != nil {
+				logger.Error("failed to update binaries", "chainID", chainID, "err", err)
+				return
+			}
+		}
 		// commit and push
 		err = gitwrap.StageToCommit(repo, chainID)
 		if err != nil {
@@ -121,6 +207,38 @@ func update(cmd *cobra.Command, args []string) (err error) {
 	return
 }
 
+// openRegistryRoot clones or opens the local copy of the root registry and
+// pulls the latest changes
+func openRegistryRoot() (repo *git.Repository, registryFolder string) {
+	registryFolder = path.Join(config.Workspace, "registry-root")
+	_, err := url.Parse(config.RegistryRoot)
+	utils.AbortIfError(err, "the registry root url is not a valid url: %s", config.RegistryRoot)
+
+	repo, err = gitwrap.CloneOrOpen(config.RegistryRoot, registryFolder, config.BasicAuth())
+	utils.AbortIfError(err, "aborted due to an error cloning registry fork repo: %v", err)
+
+	err = gitwrap.PullBranch(repo, config.RegistryRootBranch)
+	utils.AbortIfError(err, "error pulling changes for the %s branch: %v", config.RegistryRootBranch, err)
+	return
+}
+
+// peerStoreOptions are the peer store rules of the configuration
+func peerStoreOptions() node.PeerStoreOptions {
+	opts := node.DefaultPeerStoreOptions()
+	opts.MaxFailures = config.PeerMaxFailures
+	return opts
+}
+
+// classifyOptions are the peer classification references of a chain
+func classifyOptions(registryFolder, chainID string) node.ClassifyOptions {
+	opts := node.DefaultClassifyOptions()
+	opts.MaxLag = config.PeerMaxLag
+	if info, err := node.LoadChainInfo(registryFolder, chainID); err == nil {
+		opts.InitialHeight = info.InitialHeight
+	}
+	return opts
+}
+
 // myChains parses CODEOWNERS and returns a list of chainIDs that the
 // config.GitName username owns
 func myChains(co *codeowners.Codeowners, config *registrar.Config) (chainIDs []string) {
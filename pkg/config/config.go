@@ -2,6 +2,7 @@ package config
 
 import (
 	"encoding/json"
+	"time"
 
 	"github.com/go-git/go-git/v5/plumbing/transport/http"
 	"gopkg.in/yaml.v2"
@@ -24,19 +25,30 @@ func (c *Config) IsValid() bool {
 
 // Config represents the configuration for the given application
 type Config struct {
-	RPCAddr            string `json:"rpc-addr" yaml:"-" mapstructure:"-"`
-	ChainID            string `json:"chain-id" yaml:"-" mapstructure:"-"`
-	BuildRepo          string `json:"build-repo" yaml:"-" mapstructure:"-"`
-	BuildCommand       string `json:"build-command" yaml:"-" mapstructure:"-"`
-	BinaryName         string `json:"binary-name" yaml:"-" mapstructure:"-"`
-	BuildVersion       string `json:"build-version" yaml:"-" mapstructure:"-"`
-	GithubAccessToken  string `json:"github-access-token" yaml:"github-access-token" mapstructure:"github-access-token"`
-	RegistryRoot       string `json:"registry-root" yaml:"registry-root" mapstructure:"registry-root"`
-	RegistryForkName   string `json:"registry-fork-name" yaml:"registry-fork-name" mapstructure:"registry-fork-name"`
-	RegistryRootBranch string `json:"registry-root-branch" yaml:"registry-root-branch" mapstructure:"registry-root-branch"`
-	GitName            string `json:"git-name" yaml:"git-name" mapstructure:"git-name"`
-	GitEmail           string `json:"git-email" yaml:"git-email" mapstructure:"git-email"`
-	CommitMessage      string `json:"commit-message" yaml:"-" mapstructure:"-"`
+	RPCAddr            string        `json:"rpc-addr" yaml:"-" mapstructure:"-"`
+	ChainID            string        `json:"chain-id" yaml:"-" mapstructure:"-"`
+	BuildRepo          string        `json:"build-repo" yaml:"-" mapstructure:"-"`
+	BuildCommand       string        `json:"build-command" yaml:"-" mapstructure:"-"`
+	BinaryName         string        `json:"binary-name" yaml:"-" mapstructure:"-"`
+	BuildVersion       string        `json:"build-version" yaml:"-" mapstructure:"-"`
+	GithubAccessToken  string        `json:"github-access-token" yaml:"github-access-token" mapstructure:"github-access-token"`
+	RegistryRoot       string        `json:"registry-root" yaml:"registry-root" mapstructure:"registry-root"`
+	RegistryForkName   string        `json:"registry-fork-name" yaml:"registry-fork-name" mapstructure:"registry-fork-name"`
+	RegistryRootBranch string        `json:"registry-root-branch" yaml:"registry-root-branch" mapstructure:"registry-root-branch"`
+	GitName            string        `json:"git-name" yaml:"git-name" mapstructure:"git-name"`
+	GitEmail           string        `json:"git-email" yaml:"git-email" mapstructure:"git-email"`
+	CommitMessage      string        `json:"commit-message" yaml:"-" mapstructure:"-"`
+	CrawlDepth         int           `json:"crawl-depth" yaml:"crawl-depth" mapstructure:"crawl-depth"`
+	CrawlMaxPeers      int           `json:"crawl-max-peers" yaml:"crawl-max-peers" mapstructure:"crawl-max-peers"`
+	PeerMaxFailures    int           `json:"peer-max-failures" yaml:"peer-max-failures" mapstructure:"peer-max-failures"`
+	VerifyPeerIDs      bool          `json:"verify-peer-ids" yaml:"verify-peer-ids" mapstructure:"verify-peer-ids"`
+	PeerMaxLag         int64         `json:"peer-max-lag" yaml:"peer-max-lag" mapstructure:"peer-max-lag"`
+	MaxConcurrency     int           `json:"max-concurrency" yaml:"max-concurrency" mapstructure:"max-concurrency"`
+	RequestTimeout     time.Duration `json:"request-timeout" yaml:"request-timeout" mapstructure:"request-timeout"`
+	RunDeadline        time.Duration `json:"run-deadline" yaml:"run-deadline" mapstructure:"run-deadline"`
+	Quorum             string        `json:"quorum" yaml:"quorum" mapstructure:"quorum"`
+	QuorumMinPeers     int           `json:"quorum-min-peers" yaml:"quorum-min-peers" mapstructure:"quorum-min-peers"`
+	TrustingPeriod     time.Duration `json:"trusting-period" yaml:"trusting-period" mapstructure:"trusting-period"`
 	// runtime variables
 	Workspace string `json:"-" yaml:"-" mapstructure:"-"`
 }
@@ -44,13 +56,26 @@ type Config struct {
 // Binary returns the binary file representation from the config
 func (c *Config) Binary() []byte {
 	// TODO: ensure this is sorted?
-	out, _ := json.MarshalIndent(&Binary{
+	out, _ := json.MarshalIndent(c.binary(), "", "  ")
+	return out
+}
+
+// BuildInfo returns the build information of the binary, nil if none is
+// configured
+func (c *Config) BuildInfo() *Binary {
+	if *c.binary() == (Binary{}) {
+		return nil
+	}
+	return c.binary()
+}
+
+func (c *Config) binary() *Binary {
+	return &Binary{
 		Name:    c.BinaryName,
 		Repo:    c.BuildRepo,
 		Build:   c.BuildCommand,
 		Version: c.BuildVersion,
-	}, "", "  ")
-	return out
+	}
 }
 
 // YAML converts the config into yaml bytes
@@ -0,0 +1,159 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	registrar "github.com/jackzampolin/cosmos-registrar/pkg/config"
+	"github.com/jackzampolin/cosmos-registrar/pkg/utils"
+	"github.com/tendermint/tendermint/libs/log"
+)
+
+// NodeVersion is the software run by a node: the application name and
+// versions reported by /abci_info and the tendermint version reported by
+// /status
+type NodeVersion struct {
+	App        string `json:"app"`
+	Version    string `json:"version"`
+	AppVersion uint64 `json:"app-version"`
+	Tendermint string `json:"tendermint"`
+}
+
+// BinaryVersion is a version and the number of peers running it
+type BinaryVersion struct {
+	NodeVersion
+	Peers int `json:"peers"`
+}
+
+// BinaryChange records the version most peers switched to and when
+type BinaryChange struct {
+	NodeVersion
+	Height int64     `json:"height"`
+	Since  time.Time `json:"since"`
+}
+
+// Binaries describes the software run by the nodes of a chain: how to build
+// it, when provided by the chain owner, the versions run by the reachable
+// peers and the history of the version run by most of them
+type Binaries struct {
+	Build        *registrar.Binary `json:"build,omitempty"`
+	Current      NodeVersion       `json:"current"`
+	Distribution []BinaryVersion   `json:"distribution"`
+	History      []BinaryChange    `json:"history,omitempty"`
+	UpdatedAt    time.Time         `json:"updated-at"`
+}
+
+// Update replaces the distribution with the versions of the peers, a change
+// of the version run by most peers is appended to the history
+func (b *Binaries) Update(versions []NodeVersion, height int64, now time.Time) {
+	if len(versions) == 0 {
+		return
+	}
+	counts := map[NodeVersion]int{}
+	for _, v := range versions {
+		counts[v]++
+	}
+	b.Distribution = []BinaryVersion{}
+	for v, n := range counts {
+		b.Distribution = append(b.Distribution, BinaryVersion{NodeVersion: v, Peers: n})
+	}
+	sort.Slice(b.Distribution, func(i, j int) bool {
+		di, dj := b.Distribution[i], b.Distribution[j]
+		if di.Peers != dj.Peers {
+			return di.Peers > dj.Peers
+		}
+		if di.Version != dj.Version {
+			return di.Version > dj.Version
+		}
+		return di.Tendermint > dj.Tendermint
+	})
+	b.Current = b.Distribution[0].NodeVersion
+	if n := len(b.History); n == 0 || b.History[n-1].NodeVersion != b.Current {
+		b.History = append(b.History, BinaryChange{NodeVersion: b.Current, Height: height, Since: now})
+	}
+	b.UpdatedAt = now
+}
+
+// FetchNodeVersion asks a node the software it runs
+func FetchNodeVersion(ctx context.Context, rpcAddress string) (v NodeVersion, err error) {
+	client, err := Client(rpcAddress)
+	if err != nil {
+		return
+	}
+	info, err := client.ABCIInfo(ctx)
+	if err != nil {
+		return v, fmt.Errorf("fetching abci info: %s", err)
+	}
+	stat, err := client.Status(ctx)
+	if err != nil {
+		return v, fmt.Errorf("error fetching client status: %s", err)
+	}
+	return NodeVersion{
+		App:        info.Response.Data,
+		Version:    info.Response.Version,
+		AppVersion: info.Response.AppVersion,
+		Tendermint: stat.NodeInfo.Version,
+	}, nil
+}
+
+// FetchNodeVersions asks the reachable peers the software they run, the
+// peers that don't answer are left out
+func FetchNodeVersions(ctx context.Context, s *Scheduler, peers map[string]*Peer, logger log.Logger) (versions []NodeVersion) {
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	for _, peer := range peers {
+		if !peer.rpcUsable() {
+			continue
+		}
+		peer := peer
+		s.Go(ctx, &wg, func(ctx context.Context) {
+			v, err := FetchNodeVersion(ctx, peer.Address)
+			if err != nil {
+				logger.Debug("error getting node version", "peer", peer.Address, "error", err)
+				return
+			}
+			mu.Lock()
+			versions = append(versions, v)
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+	return
+}
+
+// LoadBinaries loads the binaries of a chain, a chain without binaries file
+// has no binaries recorded
+func LoadBinaries(basePath, chainID string) (b *Binaries, err error) {
+	repoRoot := repoDir{basePath, chainID}
+	b = &Binaries{}
+	if !utils.PathExists(repoRoot.binariesPath()) {
+		return
+	}
+	err = utils.FromJSON(repoRoot.binariesPath(), b)
+	return
+}
+
+// UpdateBinaries records the versions run by the peers of a chain at a
+// height in binaries.json. The build information is kept if build is nil.
+func UpdateBinaries(basePath, chainID string, build *registrar.Binary, versions []NodeVersion, height int64, logger log.Logger) (err error) {
+	b, err := LoadBinaries(basePath, chainID)
+	if err != nil {
+		return fmt.Errorf("loading binaries: %s", err)
+	}
+	if build != nil {
+		b.Build = build
+	}
+	b.Update(versions, height, time.Now())
+	out, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return
+	}
+	logger.Debug("binaries updated", "chainID", chainID, "version", b.Current.Version, "versions", len(b.Distribution))
+	return writeFile(repoDir{basePath, chainID}.binariesPath(), out, logger)
+}
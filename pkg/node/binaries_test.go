@@ -0,0 +1,77 @@
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	registrar "github.com/jackzampolin/cosmos-registrar/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/tendermint/tendermint/libs/log"
+)
+
+func TestBinariesUpdate(t *testing.T) {
+	v1 := NodeVersion{App: "GaiaApp", Version: "v4.2.1", AppVersion: 0, Tendermint: "0.34.9"}
+	v2 := NodeVersion{App: "GaiaApp", Version: "v5.0.0", AppVersion: 0, Tendermint: "0.34.10"}
+	t0 := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	b := &Binaries{}
+	b.Update([]NodeVersion{v1, v1, v2}, 100, t0)
+	assert.Equal(t, v1, b.Current)
+	assert.Equal(t, []BinaryVersion{{v1, 2}, {v2, 1}}, b.Distribution)
+	assert.Equal(t, []BinaryChange{{v1, 100, t0}}, b.History)
+
+	// the same majority does not change the history
+	b.Update([]NodeVersion{v2, v1, v1, v1}, 200, t0.Add(time.Hour))
+	assert.Equal(t, []BinaryVersion{{v1, 3}, {v2, 1}}, b.Distribution)
+	assert.Len(t, b.History, 1)
+
+	// ties go to the highest version
+	b.Update([]NodeVersion{v1, v2}, 300, t0.Add(2*time.Hour))
+	assert.Equal(t, v2, b.Current)
+	assert.Equal(t, []BinaryChange{{v1, 100, t0}, {v2, 300, t0.Add(2 * time.Hour)}}, b.History)
+
+	// no versions, nothing changes
+	b.Update(nil, 400, t0.Add(3*time.Hour))
+	assert.Equal(t, v2, b.Current)
+	assert.Equal(t, t0.Add(2*time.Hour), b.UpdatedAt)
+}
+
+func TestFetchNodeVersions(t *testing.T) {
+	v2 := NodeVersion{App: "FakeApp", Version: "v2.0.0", AppVersion: 2, Tendermint: "0.34.10"}
+	a, b, c := newFakeNode(t, "aaaa", "test-1", 10), newFakeNode(t, "bbbb", "test-1", 10), newFakeNode(t, "cccc", "test-1", 10)
+	b.SetVersion(v2)
+	peers := map[string]*Peer{}
+	for _, n := range []*fakeNode{a, b, c} {
+		p := n.Peer()
+		p.Reachable = true
+		peers[p.ID] = p
+	}
+	peers["cccc"].Reachable = false
+	peers["down"] = &Peer{ID: "down", Address: "http://127.0.0.1:1", Reachable: true}
+
+	s := NewScheduler(SchedulerOptions{Concurrency: 2, RequestTimeout: time.Second})
+	versions := FetchNodeVersions(context.Background(), s, peers, log.NewNopLogger())
+	assert.ElementsMatch(t, []NodeVersion{a.version, v2}, versions)
+}
+
+func TestUpdateBinaries(t *testing.T) {
+	registry := t.TempDir()
+	writeRegistryChain(t, registry, "test-1", "{}", nil, nil)
+	v := NodeVersion{App: "FakeApp", Version: "v1.0.0", Tendermint: "0.34.9"}
+	build := &registrar.Binary{Name: "fakad", Repo: "https://github.com/fake/fake", Build: "make install", Version: "v1.0.0"}
+
+	assert.Nil(t, UpdateBinaries(registry, "test-1", build, []NodeVersion{v}, 10, log.NewNopLogger()))
+	// the build information is kept by updates that don't have it
+	assert.Nil(t, UpdateBinaries(registry, "test-1", nil, []NodeVersion{v, v}, 20, log.NewNopLogger()))
+	b, err := LoadBinaries(registry, "test-1")
+	assert.Nil(t, err)
+	assert.Equal(t, build, b.Build)
+	assert.Equal(t, []BinaryVersion{{v, 2}}, b.Distribution)
+	assert.Equal(t, int64(10), b.History[0].Height)
+
+	// no binaries recorded yet
+	b, err = LoadBinaries(registry, "test-2")
+	assert.Nil(t, err)
+	assert.Empty(t, b.Distribution)
+}
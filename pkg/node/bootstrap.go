@@ -0,0 +1,138 @@
+package node
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/jackzampolin/cosmos-registrar/pkg/tmconfig"
+	"github.com/jackzampolin/cosmos-registrar/pkg/utils"
+	"github.com/tendermint/tendermint/libs/log"
+)
+
+// BootstrapOptions are the options to initialize a node home from the
+// registry
+type BootstrapOptions struct {
+	// Force overwrites a genesis that does not match the registered one
+	Force bool
+	// RPCServers is the number of state sync rpc servers
+	RPCServers int
+	// MaxPeers is the maximum number of persistent peers
+	MaxPeers int
+}
+
+// DefaultBootstrapOptions returns the default bootstrap options
+func DefaultBootstrapOptions() BootstrapOptions {
+	return BootstrapOptions{
+		RPCServers: DefaultStateSyncServers,
+		MaxPeers:   10,
+	}
+}
+
+// Bootstrap initializes an existing tendermint home directory with the
+// registry data of a chain: it writes the genesis, sets the seeds and the
+// persistent peers and configures state sync from the latest light root.
+func Bootstrap(basePath, chainID, home string, opts BootstrapOptions, logger log.Logger) (err error) {
+	configPath := path.Join(home, "config", "config.toml")
+	if !utils.PathExists(configPath) {
+		return fmt.Errorf("%s not found, initialize the node home first", configPath)
+	}
+	// build everything before touching the home directory
+	ss, err := NewStateSync(basePath, chainID, opts.RPCServers, logger)
+	if err != nil {
+		return
+	}
+	peers := []Peer{}
+	if err = utils.FromJSON(repoDir{basePath, chainID}.peersPath(), &peers); err != nil {
+		return fmt.Errorf("loading peers: %s", err)
+	}
+	seeds, persistent := SeedAddresses(peers), PersistentPeerAddresses(peers, opts.MaxPeers)
+
+	if err = WriteGenesis(basePath, chainID, path.Join(home, "config", "genesis.json"), opts.Force, logger); err != nil {
+		return
+	}
+	if err = tmconfig.PatchFile(configPath, "p2p", []tmconfig.Value{
+		tmconfig.String("seeds", strings.Join(seeds, ",")),
+		tmconfig.String("persistent_peers", strings.Join(persistent, ",")),
+	}); err != nil {
+		return
+	}
+	logger.Debug("p2p configured", "seeds", len(seeds), "persistent-peers", len(persistent))
+	if err = tmconfig.PatchFile(configPath, "statesync", ss.Values()); err != nil {
+		return
+	}
+	logger.Debug("state sync configured", "trust-height", ss.TrustHeight, "trust-hash", ss.TrustHash)
+	return
+}
+
+// WriteGenesis writes the genesis registered for a chain to dst, verifying
+// it against the registered checksum. A genesis already at dst is left in
+// place if its canonical form matches, otherwise it is only overwritten if
+// force is true.
+func WriteGenesis(basePath, chainID, dst string, force bool, logger log.Logger) (err error) {
+	sum, err := LoadGenesisSum(basePath, chainID)
+	if err != nil {
+		return
+	}
+	sum = strings.TrimSpace(sum)
+
+	if utils.PathExists(dst) {
+		// the genesis in place may be formatted differently, compare the
+		// canonical forms
+		actual, serr := genesisFileSum(dst)
+		switch {
+		case serr == nil && actual == sum:
+			logger.Info("genesis already in place", "path", dst)
+			return nil
+		case serr != nil && !force:
+			return fmt.Errorf("%s is not a valid genesis: %s, use force to overwrite it", dst, serr)
+		case !force:
+			return fmt.Errorf("%s has canonical sha256 %s, the registered genesis has %s, use force to overwrite it", dst, actual, sum)
+		}
+		logger.Info("overwriting mismatching genesis", "path", dst, "sha256", actual)
+	}
+
+	g, err := OpenGenesis(basePath, chainID)
+	if err != nil {
+		return
+	}
+	defer g.Close()
+	// write to a temporary file, moved in place once verified
+	tmp, err := os.CreateTemp(path.Dir(dst), ".genesis-*.json")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, h), g)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("writing genesis: %s", err)
+	}
+	if actual := fmt.Sprintf("%x", h.Sum(nil)); actual != sum {
+		return fmt.Errorf("the registered genesis has sha256 %s, expected %s", actual, sum)
+	}
+	if err = os.Chmod(tmp.Name(), 0644); err != nil {
+		return
+	}
+	if err = os.Rename(tmp.Name(), dst); err != nil {
+		return
+	}
+	logger.Info("genesis written", "path", dst, "sha256", sum)
+	return
+}
+
+func genesisFileSum(pth string) (sum string, err error) {
+	f, err := OpenGenesisFile(pth)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	sum, _, err = GenesisSum(f)
+	return
+}
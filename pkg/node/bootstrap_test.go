@@ -0,0 +1,107 @@
+package node
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tendermint/tendermint/libs/log"
+)
+
+const bootstrapConfig = `[p2p]
+laddr = "tcp://0.0.0.0:26656"
+seeds = ""
+persistent_peers = ""
+
+[statesync]
+enable = false
+rpc_servers = ""
+trust_height = 0
+trust_hash = ""
+trust_period = "168h0m0s"
+`
+
+func TestBootstrap(t *testing.T) {
+	registry, home := t.TempDir(), t.TempDir()
+	// the registry stores the canonical form of the genesis
+	raw := `{"genesis_time":"2021-06-30T00:00:00Z","chain_id":"test-1","app_state":{"staking":{"params":{"unbonding_time":"1814400s"}}}}`
+	canonical := &bytes.Buffer{}
+	_, err := CanonicalizeGenesis(strings.NewReader(raw), canonical)
+	assert.Nil(t, err)
+	genesis := canonical.String()
+	peers := []Peer{
+		{ID: "seed", Address: "http://10.0.0.1:26657", IsSeed: true, Reachable: true, LastContactHeight: 100},
+		{ID: "a", Address: "https://a.example.com:443", Reachable: true, LastContactHeight: 100},
+		{ID: "b", Address: "http://10.0.0.2:26657", Reachable: true, LastContactHeight: 99},
+		{ID: "c", Address: "http://10.0.0.3:26657", Reachable: false},
+	}
+	lrh := LightRootHistory{{TrustHeight: 20, TrustHash: "BB", Time: time.Now()}}
+	writeRegistryChain(t, registry, "test-1", genesis, peers, lrh)
+
+	configPath, genesisPath := path.Join(home, "config", "config.toml"), path.Join(home, "config", "genesis.json")
+	opts := DefaultBootstrapOptions()
+	// the home must be initialized
+	assert.NotNil(t, Bootstrap(registry, "test-1", home, opts, log.NewNopLogger()))
+
+	assert.Nil(t, os.MkdirAll(path.Join(home, "config"), 0700))
+	assert.Nil(t, os.WriteFile(configPath, []byte(bootstrapConfig), 0644))
+	assert.Nil(t, Bootstrap(registry, "test-1", home, opts, log.NewNopLogger()))
+
+	written, err := os.ReadFile(genesisPath)
+	assert.Nil(t, err)
+	assert.Equal(t, genesis, string(written))
+	written, err = os.ReadFile(configPath)
+	assert.Nil(t, err)
+	assert.Equal(t, `[p2p]
+laddr = "tcp://0.0.0.0:26656"
+seeds = "seed@10.0.0.1:26656"
+persistent_peers = "a@a.example.com:26656,b@10.0.0.2:26656"
+
+[statesync]
+enable = true
+rpc_servers = "https://a.example.com:443,http://10.0.0.1:26657,http://10.0.0.2:26657"
+trust_height = 20
+trust_hash = "BB"
+trust_period = "336h0m0s"
+`, string(written))
+
+	// running it again is harmless
+	assert.Nil(t, Bootstrap(registry, "test-1", home, opts, log.NewNopLogger()))
+
+	// the same genesis formatted differently is left in place
+	assert.Nil(t, os.WriteFile(genesisPath, []byte(raw), 0644))
+	assert.Nil(t, Bootstrap(registry, "test-1", home, opts, log.NewNopLogger()))
+	written, err = os.ReadFile(genesisPath)
+	assert.Nil(t, err)
+	assert.Equal(t, raw, string(written))
+
+	// a different genesis is only overwritten when forced
+	assert.Nil(t, os.WriteFile(genesisPath, []byte(`{"chain_id":"other"}`), 0644))
+	assert.NotNil(t, Bootstrap(registry, "test-1", home, opts, log.NewNopLogger()))
+	written, err = os.ReadFile(genesisPath)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"chain_id":"other"}`, string(written))
+	opts.Force = true
+	assert.Nil(t, Bootstrap(registry, "test-1", home, opts, log.NewNopLogger()))
+	written, err = os.ReadFile(genesisPath)
+	assert.Nil(t, err)
+	assert.Equal(t, genesis, string(written))
+}
+
+func TestWriteGenesisChecksumMismatch(t *testing.T) {
+	registry := t.TempDir()
+	writeRegistryChain(t, registry, "test-1", `{"chain_id":"test-1"}`, nil, nil)
+	assert.Nil(t, os.WriteFile(repoDir{registry, "test-1"}.genesisSumPath(), []byte("00"), 0644))
+	dst := path.Join(t.TempDir(), "genesis.json")
+	assert.NotNil(t, WriteGenesis(registry, "test-1", dst, false, log.NewNopLogger()))
+	assert.False(t, fileExists(dst))
+}
+
+func fileExists(pth string) bool {
+	_, err := os.Stat(pth)
+	return err == nil
+}
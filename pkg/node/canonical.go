@@ -0,0 +1,386 @@
+package node
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	tmjson "github.com/tendermint/tendermint/libs/json"
+	"github.com/tendermint/tendermint/types"
+)
+
+// CanonicalizeGenesis writes the canonical form of the genesis read from r to
+// w: the genesis document as tendermint encodes it, indented with two spaces.
+// The app state, that makes up almost all of large genesis files, is
+// streamed through, so that the memory used doesn't depend on its size. The
+// returned document has no app state.
+func CanonicalizeGenesis(r io.Reader, w io.Writer) (doc *types.GenesisDoc, err error) {
+	// the app state is read again once the rest of the document is known,
+	// genesis that can't be read twice are spooled to a temporary file
+	src, ok := r.(readSeekerAt)
+	if !ok {
+		spool, err := os.CreateTemp("", "genesis-*.json")
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(spool.Name())
+		defer spool.Close()
+		r, src = io.TeeReader(r, spool), spool
+	}
+	base, err := src.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return
+	}
+
+	fields := map[string]json.RawMessage{}
+	var appState *io.SectionReader
+	dec := json.NewDecoder(r)
+	if err = expectDelim(dec, '{'); err != nil {
+		return nil, fmt.Errorf("parsing genesis: %s", err)
+	}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("parsing genesis: %s", err)
+		}
+		key := t.(string)
+		if key != "app_state" {
+			var raw json.RawMessage
+			if err = dec.Decode(&raw); err != nil {
+				return nil, fmt.Errorf("parsing genesis %s: %s", key, err)
+			}
+			fields[key] = raw
+			continue
+		}
+		// the app state is validated while skipped, its position is
+		// enough to read it again
+		start := dec.InputOffset()
+		if err = skipJSON(dec); err != nil {
+			return nil, fmt.Errorf("parsing genesis app_state: %s", err)
+		}
+		appState = io.NewSectionReader(src, base+start, dec.InputOffset()-start)
+	}
+	if err = expectDelim(dec, '}'); err != nil {
+		return nil, fmt.Errorf("parsing genesis: %s", err)
+	}
+	if _, err = dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("parsing genesis: unexpected data after the genesis document")
+	}
+
+	small, err := json.Marshal(fields)
+	if err != nil {
+		return
+	}
+	if doc, err = types.GenesisDocFromJSON(small); err != nil {
+		return
+	}
+	header, err := tmjson.Marshal(doc)
+	if err != nil {
+		return
+	}
+
+	bw := bufio.NewWriterSize(w, 64*1024)
+	var body io.Reader = bytes.NewReader(header)
+	if appState != nil {
+		as := bufio.NewReaderSize(appState, 64*1024)
+		if err = skipSeparator(as); err != nil {
+			return
+		}
+		// an app state set to null is left out, as tendermint does
+		if c, _ := as.Peek(1); len(c) > 0 && c[0] != 'n' {
+			body = io.MultiReader(
+				bytes.NewReader(header[:len(header)-1]),
+				strings.NewReader(`,"app_state":`),
+				as,
+				strings.NewReader("}"),
+			)
+		}
+	}
+	if err = indentJSON(bw, bufio.NewReaderSize(body, 64*1024)); err != nil {
+		return nil, fmt.Errorf("writing genesis: %s", err)
+	}
+	if err = bw.Flush(); err != nil {
+		return nil, fmt.Errorf("writing genesis: %s", err)
+	}
+	return
+}
+
+// GenesisSum returns the checksum of the canonical form of the genesis read
+// from r
+func GenesisSum(r io.Reader) (sum string, doc *types.GenesisDoc, err error) {
+	h := sha256.New()
+	if doc, err = CanonicalizeGenesis(r, h); err != nil {
+		return
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), doc, nil
+}
+
+type readSeekerAt interface {
+	io.ReaderAt
+	io.Seeker
+}
+
+// skipSeparator skips the colon and the spaces before an object value
+func skipSeparator(r *bufio.Reader) error {
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch c {
+		case ':', ' ', '\t', '\n', '\r':
+			continue
+		}
+		return r.UnreadByte()
+	}
+}
+
+const hexDigits = "0123456789abcdef"
+
+// indentJSON copies a valid JSON value from r to w the way encoding/json
+// marshals and then indents it: spaces are removed, the characters that
+// json.Marshal escapes in raw messages are escaped, and objects and arrays
+// are indented like json.Indent does, empty ones are left as {} and [].
+func indentJSON(w *bufio.Writer, r *bufio.Reader) error {
+	var (
+		inString, escaped, needIndent bool
+		depth                         int
+	)
+	newline := func() {
+		w.WriteByte('\n')
+		for i := 0; i < depth; i++ {
+			w.WriteString("  ")
+		}
+	}
+	for {
+		c, err := r.ReadByte()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			case c == '<' || c == '>' || c == '&':
+				w.Write([]byte{'\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xF]})
+				continue
+			case c == 0xE2:
+				// U+2028 and U+2029 are E2 80 A8 and E2 80 A9
+				if next, _ := r.Peek(2); len(next) == 2 && next[0] == 0x80 && next[1]&^1 == 0xA8 {
+					w.Write([]byte{'\\', 'u', '2', '0', '2', hexDigits[next[1]&0xF]})
+					r.Discard(2)
+					continue
+				}
+			}
+			w.WriteByte(c)
+			continue
+		}
+
+		switch c {
+		case ' ', '\t', '\n', '\r':
+			continue
+		}
+		if needIndent && c != '}' && c != ']' {
+			needIndent = false
+			depth++
+			newline()
+		}
+		switch c {
+		case '"':
+			inString = true
+			w.WriteByte(c)
+		case '{', '[':
+			// empty objects and arrays are not indented
+			needIndent = true
+			w.WriteByte(c)
+		case ',':
+			w.WriteByte(c)
+			newline()
+		case ':':
+			w.WriteString(": ")
+		case '}', ']':
+			if needIndent {
+				needIndent = false
+			} else {
+				depth--
+				newline()
+			}
+			w.WriteByte(c)
+		default:
+			w.WriteByte(c)
+		}
+	}
+}
+
+// genesisSection is a top-level section of a canonical genesis. Only the
+// size and the checksum of the value are kept, along with its beginning, so
+// that sections of any size can be compared.
+type genesisSection struct {
+	size  int64
+	sum   []byte
+	short []byte
+}
+
+func (s genesisSection) String() string {
+	if s.size <= 64 && !bytes.ContainsAny(s.short, "\n") {
+		return string(s.short)
+	}
+	return fmt.Sprintf("%d bytes, sha256 %x", s.size, s.sum)
+}
+
+// sectionWriter digests the value of a section, the last byte is held back
+// so that the comma separating it from the next section can be dropped
+type sectionWriter struct {
+	h     hash.Hash
+	n     int64
+	short []byte
+	last  int
+}
+
+func newSectionWriter() *sectionWriter {
+	return &sectionWriter{h: sha256.New(), last: -1}
+}
+
+func (sw *sectionWriter) emit(b []byte) {
+	sw.h.Write(b)
+	sw.n += int64(len(b))
+	if room := 65 - len(sw.short); room > 0 {
+		if len(b) > room {
+			b = b[:room]
+		}
+		sw.short = append(sw.short, b...)
+	}
+}
+
+func (sw *sectionWriter) Write(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	if sw.last >= 0 {
+		sw.emit([]byte{byte(sw.last)})
+	}
+	sw.emit(b[:len(b)-1])
+	sw.last = int(b[len(b)-1])
+	return len(b), nil
+}
+
+func (sw *sectionWriter) section() genesisSection {
+	if sw.last >= 0 && sw.last != ',' {
+		sw.emit([]byte{byte(sw.last)})
+	}
+	return genesisSection{size: sw.n, sum: sw.h.Sum(nil), short: sw.short}
+}
+
+// genesisSections digests the top-level sections of a canonical genesis.
+// In the canonical form each top-level key starts a line indented by two
+// spaces, deeper lines are indented more.
+func genesisSections(r io.Reader) (sections map[string]genesisSection, err error) {
+	sections = map[string]genesisSection{}
+	br := bufio.NewReaderSize(r, 64*1024)
+	var (
+		key       string
+		sw        *sectionWriter
+		lineStart = true
+		first     = true
+	)
+	finish := func() {
+		if sw != nil {
+			sections[key] = sw.section()
+		}
+		sw = nil
+	}
+	for {
+		frag, err := br.ReadSlice('\n')
+		if err != nil && err != bufio.ErrBufferFull && err != io.EOF {
+			return nil, err
+		}
+		if len(frag) == 0 && err == io.EOF {
+			break
+		}
+		eol := bytes.HasSuffix(frag, []byte("\n"))
+		content := bytes.TrimSuffix(frag, []byte("\n"))
+		switch {
+		case lineStart && first:
+			// the opening brace
+			first = false
+		case lineStart && bytes.HasPrefix(content, []byte(`  "`)):
+			finish()
+			i := bytes.Index(content, []byte(`": `))
+			if i < 0 {
+				return nil, errors.New("malformed genesis section")
+			}
+			if err := json.Unmarshal(content[2:i+1], &key); err != nil {
+				return nil, err
+			}
+			sw = newSectionWriter()
+			sw.Write(content[i+3:])
+		case lineStart && bytes.Equal(content, []byte("}")):
+			finish()
+		case sw != nil:
+			if lineStart {
+				sw.Write([]byte("\n"))
+			}
+			sw.Write(content)
+		}
+		lineStart = eol
+		if err == io.EOF {
+			break
+		}
+	}
+	finish()
+	return
+}
+
+// diffGenesis compares the top-level sections of two canonical genesis
+func diffGenesis(local, registered io.Reader) (diff []SectionDiff, err error) {
+	l, err := genesisSections(local)
+	if err != nil {
+		return
+	}
+	r, err := genesisSections(registered)
+	if err != nil {
+		return nil, fmt.Errorf("parsing registered genesis: %s", err)
+	}
+	keys := []string{}
+	for k := range l {
+		keys = append(keys, k)
+	}
+	for k := range r {
+		if _, ok := l[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		ls, lok := l[k]
+		rs, rok := r[k]
+		if lok && rok && bytes.Equal(ls.sum, rs.sum) {
+			continue
+		}
+		d := SectionDiff{Key: k, Local: "missing", Registered: "missing"}
+		if lok {
+			d.Local = ls.String()
+		}
+		if rok {
+			d.Registered = rs.String()
+		}
+		diff = append(diff, d)
+	}
+	return
+}
@@ -0,0 +1,250 @@
+package node
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	tmjson "github.com/tendermint/tendermint/libs/json"
+	"github.com/tendermint/tendermint/libs/log"
+	"github.com/tendermint/tendermint/types"
+)
+
+// sortedGenesis is how the registry canonicalized the genesis before it was
+// streamed, the canonical form must stay byte identical to its output
+func sortedGenesis(gen *types.GenesisDoc) (sum string, indented []byte, err error) {
+	// prepare to sort
+	if indented, err = tmjson.Marshal(gen); err != nil {
+		return
+	}
+
+	// sort
+	c, err := types.GenesisDocFromJSON(indented)
+	if err != nil {
+		return
+	}
+
+	// indent
+	if indented, err = tmjson.MarshalIndent(c, "", "  "); err != nil {
+		return
+	}
+
+	// sum
+	sum = fmt.Sprintf("%x", sha256.Sum256(indented))
+	return
+}
+
+// onlyReader hides the other methods of a reader, so that the genesis
+// can't be read twice
+type onlyReader struct{ io.Reader }
+
+// doneReader fails the test if it is read after done is set
+type doneReader struct {
+	t    *testing.T
+	r    io.Reader
+	mu   sync.Mutex
+	done bool
+}
+
+func (r *doneReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.done {
+		r.t.Error("genesis read after StoreGenesis returned")
+	}
+	return r.r.Read(p)
+}
+
+func TestStoreGenesisWriteFails(t *testing.T) {
+	raw, err := tmjson.Marshal(fakeGenesis("test-1", newFakeValSet(2)))
+	assert.Nil(t, err)
+	// the chain folder is missing, so the parts can't be written
+	r := &doneReader{t: t, r: io.MultiReader(bytes.NewReader(raw), strings.NewReader(strings.Repeat(" ", 4*1024*1024)))}
+	doc, err := StoreGenesis(t.TempDir(), "test-1", r, log.NewNopLogger())
+	r.mu.Lock()
+	r.done = true
+	r.mu.Unlock()
+	assert.NotNil(t, err)
+	assert.Nil(t, doc)
+}
+
+func TestCanonicalizeGenesis(t *testing.T) {
+	vals := newFakeValSet(2)
+	withVals, err := tmjson.Marshal(fakeGenesis("test-1", vals))
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{"validators", string(withVals)},
+		{"app state first", "{\n\t\"app_state\" : {\n  \"a\" :\t[ 1, 2 ,3 ],\r\n \"b\":{}} ,\"chain_id\": \"test-1\", \"genesis_time\":\"2021-06-01T12:00:00Z\"}\n"},
+		{"escapes", `{"chain_id":"test-1","genesis_time":"2021-06-01T12:00:00Z","app_state":{"html":"<a href=\"x\">&amp;</a>","sep":"a` + "\u2028b\u2029c" + `","e":"é\/\\","k\"ey<":"\\\"","utf8":"` + "é€‧" + `"}}`},
+		{"literals", `{"chain_id":"test-1","genesis_time":"2021-06-01T12:00:00Z","app_state":{"n":[1e10,-0.5,0,true,false,null],"o":{"":[[],{}],"x":[{"y":[]}]}}}`},
+		{"duplicate keys", `{"chain_id":"test-2","genesis_time":"2021-06-01T12:00:00Z","app_state":{"a":1},"chain_id":"test-1","app_state":{"b":2}}`},
+		{"null app state", `{"chain_id":"test-1","genesis_time":"2021-06-01T12:00:00Z","app_state":null}`},
+		{"no app state", `{"chain_id":"test-1","genesis_time":"2021-06-01T12:00:00Z","consensus_params":null}`},
+		{"string app state", `{"app_state":"x<y","chain_id":"test-1","genesis_time":"2021-06-01T12:00:00Z"}`},
+		{"unknown keys", `{"chain_id":"test-1","genesis_time":"2021-06-01T12:00:00Z","foo":{"bar":[1]},"app_state":[]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := types.GenesisDocFromJSON([]byte(tt.raw))
+			assert.Nil(t, err)
+			wantSum, want, err := sortedGenesis(doc)
+			assert.Nil(t, err)
+
+			for _, r := range []io.Reader{strings.NewReader(tt.raw), onlyReader{strings.NewReader(tt.raw)}} {
+				got := &bytes.Buffer{}
+				doc, err := CanonicalizeGenesis(r, got)
+				assert.Nil(t, err)
+				assert.Equal(t, string(want), got.String())
+				assert.Equal(t, "test-1", doc.ChainID)
+				assert.Nil(t, doc.AppState)
+			}
+			sum, _, err := GenesisSum(strings.NewReader(tt.raw))
+			assert.Nil(t, err)
+			assert.Equal(t, wantSum, sum)
+		})
+	}
+
+	for _, raw := range []string{
+		``,
+		`[]`,
+		`{"chain_id":"test-1","app_state":{"a":}}`,
+		`{"chain_id":"test-1","app_state":{"a":1}`,
+		`{"chain_id":"test-1"} {}`,
+		`{"chain_id":""}`,
+		`{"chain_id":"test-1","initial_height":"x"}`,
+	} {
+		_, err := CanonicalizeGenesis(strings.NewReader(raw), io.Discard)
+		assert.NotNil(t, err, raw)
+	}
+}
+
+func TestDiffGenesis(t *testing.T) {
+	canonical := func(doc *types.GenesisDoc) io.Reader {
+		_, indented, err := sortedGenesis(doc)
+		assert.Nil(t, err)
+		return bytes.NewReader(indented)
+	}
+	a := testGenesisDoc("test-1", `{"bank":{"balances":[]},"staking":{"params":{"unbonding_time":"1814400s"}}}`)
+	b := testGenesisDoc("test-2", `{"bank":{"balances":[]},"staking":{"params":{"unbonding_time":"1209600s"}}}`)
+	b.AppHash = []byte{1, 2}
+	noState := testGenesisDoc("test-1", ``)
+	noState.AppState = nil
+
+	diff, err := diffGenesis(canonical(a), canonical(a))
+	assert.Nil(t, err)
+	assert.Empty(t, diff)
+
+	diff, err = diffGenesis(canonical(a), canonical(b))
+	assert.Nil(t, err)
+	assert.Equal(t, []SectionDiff{
+		{Key: "app_hash", Local: `""`, Registered: `"0102"`},
+		{Key: "app_state", Local: diff[1].Local, Registered: diff[1].Registered},
+		{Key: "chain_id", Local: `"test-1"`, Registered: `"test-2"`},
+	}, diff)
+	assert.Contains(t, diff[1].Local, "sha256")
+	assert.NotEqual(t, diff[1].Local, diff[1].Registered)
+
+	diff, err = diffGenesis(canonical(noState), canonical(a))
+	assert.Nil(t, err)
+	if assert.Len(t, diff, 1) {
+		assert.Equal(t, "app_state", diff[0].Key)
+		assert.Equal(t, "missing", diff[0].Local)
+	}
+}
+
+// writeLargeGenesis writes a genesis with a bank module of about size bytes
+func writeLargeGenesis(t *testing.T, pth string, size int) {
+	f, err := os.Create(pth)
+	assert.Nil(t, err)
+	w := bufio.NewWriter(f)
+	fmt.Fprint(w, `{"genesis_time":"2021-06-01T12:00:00Z","chain_id":"test-1","app_state":{"bank":{"balances":[`)
+	for i, n := 0, 0; n < size; i++ {
+		if i > 0 {
+			w.WriteString(",")
+		}
+		m, _ := fmt.Fprintf(w, `{"address":"cosmos1%038d","coins":[{"denom":"uatom","amount":"%d"},{"denom":"<ibc&%d>","amount":"1"}]}`, i, i*7919, i%97)
+		n += m
+	}
+	fmt.Fprint(w, `]},"staking":{"params":{"unbonding_time":"1814400s"}}},"app_hash":""}`)
+	assert.Nil(t, w.Flush())
+	assert.Nil(t, f.Close())
+}
+
+func TestStoreLargeGenesis(t *testing.T) {
+	if testing.Short() {
+		t.Skip("large genesis")
+	}
+	dir := t.TempDir()
+	pth := path.Join(dir, "genesis.json")
+	writeLargeGenesis(t, pth, 300*1024*1024)
+
+	// sample the heap while the genesis is stored
+	var (
+		peak uint64
+		done = make(chan struct{})
+		wg   sync.WaitGroup
+	)
+	runtime.GC()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ms := &runtime.MemStats{}
+		for {
+			runtime.ReadMemStats(ms)
+			if ms.HeapAlloc > peak {
+				peak = ms.HeapAlloc
+			}
+			select {
+			case <-done:
+				return
+			case <-time.After(20 * time.Millisecond):
+			}
+		}
+	}()
+	registry := t.TempDir()
+	assert.Nil(t, os.MkdirAll(repoDir{registry, "test-1"}.chainPath(), 0755))
+	f, err := os.Open(pth)
+	assert.Nil(t, err)
+	doc, err := StoreGenesis(registry, "test-1", onlyReader{f}, log.NewNopLogger())
+	assert.Nil(t, err)
+	assert.Nil(t, f.Close())
+	close(done)
+	wg.Wait()
+	assert.Equal(t, "test-1", doc.ChainID)
+	assert.Less(t, peak, uint64(64*1024*1024), "heap grew to %d bytes", peak)
+
+	// the same genesis as canonicalized in memory
+	raw, err := os.ReadFile(pth)
+	assert.Nil(t, err)
+	ref, err := types.GenesisDocFromJSON(raw)
+	assert.Nil(t, err)
+	raw = nil
+	want, _, err := sortedGenesis(ref)
+	assert.Nil(t, err)
+	ref = nil
+	runtime.GC()
+
+	sum, err := LoadGenesisSum(registry, "test-1")
+	assert.Nil(t, err)
+	assert.Equal(t, want, sum)
+	g, err := OpenGenesis(registry, "test-1")
+	assert.Nil(t, err)
+	n, err := io.Copy(io.Discard, g)
+	assert.Nil(t, err)
+	assert.Nil(t, g.Close())
+	assert.Greater(t, n, int64(300*1024*1024))
+}
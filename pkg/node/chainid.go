@@ -0,0 +1,81 @@
+package node
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// caip2Reference is the format of the chain IDs the CAIP-2 cosmos
+	// namespace uses as they are, the others are only referenced by hash
+	caip2Reference = regexp.MustCompile(`^[-a-zA-Z0-9]{1,32}$`)
+	// revisionFormat is the name-revision format of the chain IDs of chains
+	// that can be upgraded to a new revision, as defined by ibc
+	revisionFormat = regexp.MustCompile(`^.*[^\n-]-{1}[1-9][0-9]*$`)
+)
+
+// ChainID is a chain ID that can be used as a registry name. Chain IDs in
+// the name-revision format, like cosmoshub-4, have their name and revision
+// parsed, the revision of the other ones is 0.
+type ChainID struct {
+	ID       string
+	Name     string
+	Revision uint64
+}
+
+// ParseChainID validates a chain ID according to the CAIP-2 cosmos namespace
+// and parses its revision. Chain IDs that CAIP-2 only references by hash
+// are rejected, as are the ones that are not safe as a path.
+func ParseChainID(id string) (c ChainID, err error) {
+	switch {
+	case !caip2Reference.MatchString(id):
+		return c, fmt.Errorf("invalid chain ID %q: a CAIP-2 cosmos chain ID has 1 to 32 letters, digits and dashes", id)
+	case strings.HasPrefix(id, "hashed-"):
+		return c, fmt.Errorf("invalid chain ID %q: the hashed- prefix is reserved by CAIP-2", id)
+	}
+	c = ChainID{ID: id, Name: id}
+	if !revisionFormat.MatchString(id) {
+		return
+	}
+	i := strings.LastIndexByte(id, '-')
+	rev, err := strconv.ParseUint(id[i+1:], 10, 64)
+	if err != nil {
+		return c, fmt.Errorf("invalid chain ID %q: revision: %s", id, err)
+	}
+	c.Name, c.Revision = id[:i], rev
+	return
+}
+
+// CAIP2 returns the CAIP-2 identifier of the chain
+func (c ChainID) CAIP2() string { return "cosmos:" + c.ID }
+
+// String returns the chain ID
+func (c ChainID) String() string { return c.ID }
+
+// RegisteredRevisions returns the other revisions of a chain that are in the
+// registry, sorted by revision
+func RegisteredRevisions(basePath string, c ChainID) (revisions []ChainID, err error) {
+	if c.Revision == 0 {
+		return
+	}
+	entries, err := os.ReadDir(basePath)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		other, err := ParseChainID(e.Name())
+		if err != nil || other.Name != c.Name || other.Revision == 0 || other.ID == c.ID {
+			continue
+		}
+		revisions = append(revisions, other)
+	}
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i].Revision < revisions[j].Revision })
+	return
+}
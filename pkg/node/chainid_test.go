@@ -0,0 +1,76 @@
+package node
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseChainID(t *testing.T) {
+	tests := []struct {
+		id      string
+		want    ChainID
+		wantErr bool
+	}{
+		{"cosmoshub-4", ChainID{"cosmoshub-4", "cosmoshub", 4}, false},
+		{"osmosis-1", ChainID{"osmosis-1", "osmosis", 1}, false},
+		{"irishub-1-12", ChainID{"irishub-1-12", "irishub-1", 12}, false},
+		{"testchain", ChainID{"testchain", "testchain", 0}, false},
+		{"juno-0", ChainID{"juno-0", "juno-0", 0}, false},
+		{"juno-01", ChainID{"juno-01", "juno-01", 0}, false},
+		{"juno--1", ChainID{"juno--1", "juno--1", 0}, false},
+		{"-1", ChainID{"-1", "-1", 0}, false},
+		{strings.Repeat("a", 32), ChainID{strings.Repeat("a", 32), strings.Repeat("a", 32), 0}, false},
+		{"", ChainID{}, true},
+		{strings.Repeat("a", 33), ChainID{}, true},
+		{"../cosmoshub-4", ChainID{}, true},
+		{"cosmos/hub-4", ChainID{}, true},
+		{"cosmos.hub-4", ChainID{}, true},
+		{"evmos_9001-2", ChainID{}, true},
+		{"cosmos hub", ChainID{}, true},
+		{"hashed-c1f2e0a1b2c3d4e5", ChainID{}, true},
+		{"x-99999999999999999999", ChainID{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			got, err := ParseChainID(tt.id)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+	c, err := ParseChainID("cosmoshub-4")
+	assert.Nil(t, err)
+	assert.Equal(t, "cosmos:cosmoshub-4", c.CAIP2())
+}
+
+func TestRegisteredRevisions(t *testing.T) {
+	registry := t.TempDir()
+	for _, d := range []string{"cosmoshub-4", "cosmoshub-2", "cosmoshub-3", "cosmoshub", "cosmoshubb-1", "osmosis-1"} {
+		assert.Nil(t, os.Mkdir(path.Join(registry, d), 0755))
+	}
+	assert.Nil(t, os.WriteFile(path.Join(registry, "cosmoshub-1"), nil, 0644))
+
+	c, err := ParseChainID("cosmoshub-4")
+	assert.Nil(t, err)
+	revisions, err := RegisteredRevisions(registry, c)
+	assert.Nil(t, err)
+	ids := []string{}
+	for _, r := range revisions {
+		ids = append(ids, r.ID)
+	}
+	assert.Equal(t, []string{"cosmoshub-2", "cosmoshub-3"}, ids)
+
+	// chains without revision have no other revisions
+	c, err = ParseChainID("cosmoshub")
+	assert.Nil(t, err)
+	revisions, err = RegisteredRevisions(registry, c)
+	assert.Nil(t, err)
+	assert.Empty(t, revisions)
+}
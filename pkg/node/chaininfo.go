@@ -0,0 +1,432 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackzampolin/cosmos-registrar/pkg/utils"
+	"github.com/tendermint/tendermint/libs/log"
+)
+
+// ChainInfo summarizes the genesis of a chain for the registry consumers.
+// The fields taken from the Cosmos SDK modules are left empty for chains
+// that don't have them.
+type ChainInfo struct {
+	ChainID           string    `json:"chain-id"`
+	GenesisTime       time.Time `json:"genesis-time"`
+	InitialHeight     int64     `json:"initial-height"`
+	Bech32Prefix      string    `json:"bech32-prefix,omitempty"`
+	BondDenom         string    `json:"bond-denom,omitempty"`
+	UnbondingTime     string    `json:"unbonding-time,omitempty"`
+	InitialValidators int       `json:"initial-validators"`
+	TotalSupply       []Coin    `json:"total-supply,omitempty"`
+	// ChainName and Revision are parsed from the chain ID, the earlier
+	// revisions of the chain in the registry are listed in PreviousRevisions
+	ChainName         string   `json:"chain-name,omitempty"`
+	Revision          uint64   `json:"revision,omitempty"`
+	PreviousRevisions []string `json:"previous-revisions,omitempty"`
+}
+
+// Coin is an amount of a denomination, the amount is a decimal integer
+type Coin struct {
+	Denom  string `json:"denom"`
+	Amount string `json:"amount"`
+}
+
+// coinSums adds up amounts by denomination
+type coinSums map[string]*big.Int
+
+func (cs coinSums) add(coins []Coin) error {
+	for _, c := range coins {
+		a, ok := new(big.Int).SetString(c.Amount, 10)
+		if !ok {
+			return fmt.Errorf("invalid amount %q of %s", c.Amount, c.Denom)
+		}
+		if cs[c.Denom] == nil {
+			cs[c.Denom] = new(big.Int)
+		}
+		cs[c.Denom].Add(cs[c.Denom], a)
+	}
+	return nil
+}
+
+// coins returns the sums sorted by denomination
+func (cs coinSums) coins() (coins []Coin) {
+	for d, a := range cs {
+		coins = append(coins, Coin{Denom: d, Amount: a.String()})
+	}
+	sort.Slice(coins, func(i, j int) bool { return coins[i].Denom < coins[j].Denom })
+	return
+}
+
+// moduleSummary is what the app state modules contribute to the chain
+// summary, the contributions of a module that cannot be read are dropped
+type moduleSummary struct {
+	bech32Prefix, valoperPrefix string
+	bondDenom, unbonding        string
+	bondedValidators, genTxs    int
+	supply, balances            coinSums
+}
+
+func (m moduleSummary) clone() moduleSummary {
+	m.supply, m.balances = m.supply.clone(), m.balances.clone()
+	return m
+}
+
+func (cs coinSums) clone() coinSums {
+	out := make(coinSums, len(cs))
+	for d, a := range cs {
+		out[d] = new(big.Int).Set(a)
+	}
+	return out
+}
+
+// isBonded tells if a staking validator status is bonded, either as the enum
+// name of recent versions or as the amino encoded number
+func isBonded(status json.RawMessage) bool {
+	switch strings.Trim(string(status), `"`) {
+	case "BOND_STATUS_BONDED", "Bonded", "2":
+		return true
+	}
+	return false
+}
+
+// ReadChainInfo extracts the chain summary from a genesis document. The
+// document is streamed, the balances are added up one account at a time.
+//
+// The initial validators are the genesis validators or, for chains that
+// leave them to the application, the bonded staking validators plus the
+// genesis transactions. The total supply is the bank supply, or the sum of
+// the balances when the supply is left to be computed at genesis.
+//
+// The summary is best effort: an app state module with an unexpected shape
+// is logged and left out of the summary.
+func ReadChainInfo(r io.Reader, logger log.Logger) (info *ChainInfo, err error) {
+	info = &ChainInfo{}
+	var (
+		validators int
+		sum        = moduleSummary{supply: coinSums{}, balances: coinSums{}}
+	)
+	dec := json.NewDecoder(r)
+	modules := map[string]func() error{
+		"auth": func() error {
+			return walkObject(dec, func(key string) error {
+				if key != "accounts" {
+					return skipJSON(dec)
+				}
+				return walkArray(dec, func() error {
+					acc := struct {
+						Address     string `json:"address"`
+						BaseAccount struct {
+							Address string `json:"address"`
+						} `json:"base_account"`
+						Value struct {
+							Address string `json:"address"`
+						} `json:"value"`
+					}{}
+					if err := dec.Decode(&acc); err != nil {
+						return err
+					}
+					for _, a := range []string{acc.Address, acc.BaseAccount.Address, acc.Value.Address} {
+						if sum.bech32Prefix == "" {
+							sum.bech32Prefix = bech32Prefix(a)
+						}
+					}
+					return nil
+				})
+			})
+		},
+		"bank": func() error {
+			return walkObject(dec, func(key string) error {
+				switch key {
+				case "balances":
+					return walkArray(dec, func() error {
+						b := struct {
+							Address string `json:"address"`
+							Coins   []Coin `json:"coins"`
+						}{}
+						if err := dec.Decode(&b); err != nil {
+							return err
+						}
+						if sum.bech32Prefix == "" {
+							sum.bech32Prefix = bech32Prefix(b.Address)
+						}
+						return sum.balances.add(b.Coins)
+					})
+				case "supply":
+					return decodeCoins(dec, sum.supply)
+				}
+				return skipJSON(dec)
+			})
+		},
+		// the supply module of the SDK versions before 0.40
+		"supply": func() error {
+			return walkObject(dec, func(key string) error {
+				if key != "supply" {
+					return skipJSON(dec)
+				}
+				return decodeCoins(dec, sum.supply)
+			})
+		},
+		"staking": func() error {
+			return walkObject(dec, func(key string) error {
+				switch key {
+				case "params":
+					params := struct {
+						BondDenom     string          `json:"bond_denom"`
+						UnbondingTime json.RawMessage `json:"unbonding_time"`
+					}{}
+					if err := dec.Decode(&params); err != nil {
+						return err
+					}
+					sum.bondDenom = params.BondDenom
+					if len(params.UnbondingTime) > 0 {
+						if err := json.Unmarshal(params.UnbondingTime, &sum.unbonding); err != nil {
+							return fmt.Errorf("unbonding_time: %s", err)
+						}
+						if _, err := parseUnbondingTime(sum.unbonding); err != nil {
+							return fmt.Errorf("unbonding_time: %s", err)
+						}
+					}
+					return nil
+				case "validators":
+					return walkArray(dec, func() error {
+						v := struct {
+							OperatorAddress string          `json:"operator_address"`
+							Status          json.RawMessage `json:"status"`
+						}{}
+						if err := dec.Decode(&v); err != nil {
+							return err
+						}
+						if isBonded(v.Status) {
+							sum.bondedValidators++
+						}
+						if sum.valoperPrefix == "" {
+							sum.valoperPrefix = strings.TrimSuffix(bech32Prefix(v.OperatorAddress), "valoper")
+						}
+						return nil
+					})
+				}
+				return skipJSON(dec)
+			})
+		},
+		"genutil": func() error {
+			return walkObject(dec, func(key string) error {
+				// gentxs in the amino encoded genesis files
+				if key != "gen_txs" && key != "gentxs" {
+					return skipJSON(dec)
+				}
+				return walkArray(dec, func() error {
+					sum.genTxs++
+					return skipJSON(dec)
+				})
+			})
+		},
+	}
+
+	err = walkObject(dec, func(key string) error {
+		switch key {
+		case "chain_id":
+			return dec.Decode(&info.ChainID)
+		case "genesis_time":
+			return dec.Decode(&info.GenesisTime)
+		case "initial_height":
+			// encoded as a string by tendermint
+			var h json.RawMessage
+			if err := dec.Decode(&h); err != nil {
+				return err
+			}
+			n, err := strconv.ParseInt(strings.Trim(string(h), `"`), 10, 64)
+			if err != nil {
+				return fmt.Errorf("initial_height: %s", err)
+			}
+			info.InitialHeight = n
+			return nil
+		case "validators":
+			return walkArray(dec, func() error {
+				validators++
+				return skipJSON(dec)
+			})
+		case "app_state":
+			return walkObject(dec, func(module string) error {
+				read, ok := modules[module]
+				if !ok {
+					return skipJSON(dec)
+				}
+				saved := sum.clone()
+				if err := read(); err != nil {
+					if _, ok := err.(*json.SyntaxError); ok {
+						return err
+					}
+					logger.Info("skipping unexpected genesis module in the chain info", "module", module, "error", err)
+					sum = saved
+				}
+				return nil
+			})
+		}
+		return skipJSON(dec)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading chain info: %s", err)
+	}
+
+	info.BondDenom = sum.bondDenom
+	if sum.unbonding != "" {
+		d, _ := parseUnbondingTime(sum.unbonding)
+		info.UnbondingTime = fmt.Sprintf("%ds", d/time.Second)
+	}
+	if info.InitialHeight == 0 {
+		info.InitialHeight = 1
+	}
+	info.InitialValidators = validators
+	if validators == 0 {
+		info.InitialValidators = sum.bondedValidators + sum.genTxs
+	}
+	info.Bech32Prefix = sum.bech32Prefix
+	if info.Bech32Prefix == "" {
+		info.Bech32Prefix = sum.valoperPrefix
+	}
+	info.TotalSupply = sum.supply.coins()
+	if len(info.TotalSupply) == 0 {
+		info.TotalSupply = sum.balances.coins()
+	}
+	return
+}
+
+// WriteChainInfo writes the summary of the genesis registered for a chain
+// to chain.json, along with the revisions of the chain that precede it
+func WriteChainInfo(basePath, chainID string, logger log.Logger) (err error) {
+	c, err := ParseChainID(chainID)
+	if err != nil {
+		return
+	}
+	g, err := OpenGenesis(basePath, chainID)
+	if err != nil {
+		return
+	}
+	defer g.Close()
+	info, err := ReadChainInfo(g, logger)
+	if err != nil {
+		return
+	}
+	info.ChainName, info.Revision = c.Name, c.Revision
+	revisions, err := RegisteredRevisions(basePath, c)
+	if err != nil {
+		return
+	}
+	for _, r := range revisions {
+		if r.Revision < c.Revision {
+			info.PreviousRevisions = append(info.PreviousRevisions, r.ID)
+		}
+	}
+	out, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return
+	}
+	return writeFile(repoDir{basePath, chainID}.chainInfoPath(), out, logger)
+}
+
+// LoadChainInfo loads the chain.json summary of a chain
+func LoadChainInfo(basePath, chainID string) (info *ChainInfo, err error) {
+	info = &ChainInfo{}
+	err = utils.FromJSON(repoDir{basePath, chainID}.chainInfoPath(), info)
+	return
+}
+
+// bech32Prefix returns the human readable part of a bech32 address
+func bech32Prefix(address string) string {
+	if i := strings.LastIndexByte(address, '1'); i > 0 {
+		return address[:i]
+	}
+	return ""
+}
+
+func decodeCoins(dec *json.Decoder, cs coinSums) error {
+	coins := []Coin{}
+	if err := dec.Decode(&coins); err != nil {
+		return err
+	}
+	return cs.add(coins)
+}
+
+// walkObject calls fn with each key of the next object of the decoder, fn
+// has to consume the value. A null is an empty object. On errors the rest of
+// the value is consumed.
+func walkObject(dec *json.Decoder, fn func(key string) error) error {
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch t {
+	case nil:
+		return nil
+	case json.Delim('{'):
+	case json.Delim('['):
+		return skipRest(dec, fmt.Errorf("expected an object, found an array"))
+	default:
+		return fmt.Errorf("expected an object, found %v", t)
+	}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if err = fn(t.(string)); err != nil {
+			return skipRest(dec, err)
+		}
+	}
+	return expectDelim(dec, '}')
+}
+
+// walkArray calls fn for each element of the next array of the decoder, fn
+// has to consume the element. A null is an empty array. On errors the rest of
+// the value is consumed.
+func walkArray(dec *json.Decoder, fn func() error) error {
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch t {
+	case nil:
+		return nil
+	case json.Delim('['):
+	case json.Delim('{'):
+		return skipRest(dec, fmt.Errorf("expected an array, found an object"))
+	default:
+		return fmt.Errorf("expected an array, found %v", t)
+	}
+	for dec.More() {
+		if err = fn(); err != nil {
+			return skipRest(dec, err)
+		}
+	}
+	return expectDelim(dec, ']')
+}
+
+// skipRest consumes the rest of the object or array the decoder is in, so
+// that reading can go on after a value that fn could not handle, and returns
+// err. Syntax errors are returned as they are.
+func skipRest(dec *json.Decoder, err error) error {
+	if _, ok := err.(*json.SyntaxError); ok {
+		return err
+	}
+	for depth := 1; depth > 0; {
+		t, terr := dec.Token()
+		if terr != nil {
+			return terr
+		}
+		switch t {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+	return err
+}
@@ -0,0 +1,145 @@
+package node
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackzampolin/cosmos-registrar/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/tendermint/tendermint/libs/log"
+)
+
+func TestReadChainInfo(t *testing.T) {
+	genesisTime := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		genesis string
+		want    ChainInfo
+	}{
+		{
+			"stargate",
+			`{"genesis_time":"2021-06-01T12:00:00Z","chain_id":"test-1","initial_height":"5","validators":[],"app_state":{
+				"auth":{"accounts":[{"@type":"/cosmos.auth.v1beta1.BaseAccount","address":"cosmos1aaa"}]},
+				"bank":{"balances":[
+					{"address":"cosmos1aaa","coins":[{"denom":"uatom","amount":"100000000000000000000"}]},
+					{"address":"cosmos1bbb","coins":[{"denom":"stake","amount":"5"},{"denom":"uatom","amount":"1"}]}
+				],"supply":[]},
+				"genutil":{"gen_txs":[{},{}]},
+				"staking":{"params":{"bond_denom":"uatom","unbonding_time":"1814400s"},"validators":[
+					{"operator_address":"cosmosvaloper1aaa","status":"BOND_STATUS_UNBONDED"}
+				]},
+				"wasm":{"codes":[]}
+			}}`,
+			ChainInfo{
+				ChainID:           "test-1",
+				GenesisTime:       genesisTime,
+				InitialHeight:     5,
+				Bech32Prefix:      "cosmos",
+				BondDenom:         "uatom",
+				UnbondingTime:     "1814400s",
+				InitialValidators: 2,
+				TotalSupply:       []Coin{{"stake", "5"}, {"uatom", "100000000000000000001"}},
+			},
+		},
+		{
+			"amino",
+			`{"genesis_time":"2021-06-01T12:00:00Z","chain_id":"test-1","app_state":{
+				"auth":{"accounts":[{"type":"cosmos-sdk/Account","value":{"address":"terra1xyz","coins":[]}}]},
+				"supply":{"supply":[{"denom":"uluna","amount":"10"}]},
+				"genutil":{"gentxs":[{}]},
+				"staking":{"params":{"bond_denom":"uluna","unbonding_time":"1814400000000000"},
+					"validators":[{"operator_address":"terravaloper1abc","status":2},{"operator_address":"terravaloper1def","status":2},{"operator_address":"terravaloper1ghi","status":1}]}
+			}}`,
+			ChainInfo{
+				ChainID:           "test-1",
+				GenesisTime:       genesisTime,
+				InitialHeight:     1,
+				Bech32Prefix:      "terra",
+				BondDenom:         "uluna",
+				UnbondingTime:     "1814400s",
+				InitialValidators: 3,
+				TotalSupply:       []Coin{{"uluna", "10"}},
+			},
+		},
+		{
+			"validators only",
+			`{"genesis_time":"2021-06-01T12:00:00Z","chain_id":"test-1","validators":[{"power":"1"}],"app_state":{
+				"staking":{"validators":[{"operator_address":"osmovaloper1abc"}]}
+			}}`,
+			ChainInfo{
+				ChainID:           "test-1",
+				GenesisTime:       genesisTime,
+				InitialHeight:     1,
+				Bech32Prefix:      "osmo",
+				InitialValidators: 1,
+			},
+		},
+		{
+			"unexpected modules",
+			`{"genesis_time":"2021-06-01T12:00:00Z","chain_id":"test-1","app_state":{
+				"auth":{"accounts":[{"address":"cosmos1aaa"}]},
+				"bank":[],
+				"genutil":{"gen_txs":{}},
+				"staking":{"params":{"bond_denom":"uatom","unbonding_time":"3 weeks"},"validators":[
+					{"operator_address":"cosmosvaloper1aaa","status":"BOND_STATUS_BONDED"}
+				]},
+				"supply":{"supply":[{"denom":"uatom","amount":"1.5"}]}
+			}}`,
+			ChainInfo{
+				ChainID:       "test-1",
+				GenesisTime:   genesisTime,
+				InitialHeight: 1,
+				Bech32Prefix:  "cosmos",
+			},
+		},
+		{
+			"no app state",
+			`{"genesis_time":"2021-06-01T12:00:00Z","chain_id":"test-1","app_state":null}`,
+			ChainInfo{ChainID: "test-1", GenesisTime: genesisTime, InitialHeight: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := ReadChainInfo(strings.NewReader(tt.genesis), log.NewNopLogger())
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, *info)
+		})
+	}
+
+	for _, genesis := range []string{
+		`{"chain_id":"test-1","initial_height":"x"}`,
+		`{"chain_id":"test-1","app_state":{"bank":{"balances":[{"address":"a",}]}}}`,
+		`[]`,
+	} {
+		_, err := ReadChainInfo(strings.NewReader(genesis), log.NewNopLogger())
+		assert.NotNil(t, err, genesis)
+	}
+}
+
+func TestWriteChainInfo(t *testing.T) {
+	registry := t.TempDir()
+	doc := testGenesisDoc("test-1", `{"staking":{"params":{"bond_denom":"stake","unbonding_time":"1814400s"}}}`)
+	_, indented, err := sortedGenesis(doc)
+	assert.Nil(t, err)
+	writeRegistryChain(t, registry, "test-1", string(indented), nil, nil)
+
+	assert.Nil(t, WriteChainInfo(registry, "test-1", log.NewNopLogger()))
+	raw, err := os.ReadFile(path.Join(registry, "test-1", "chain.json"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(raw), `"bond-denom": "stake"`)
+	assert.Contains(t, string(raw), `"genesis-time": "2021-06-01T12:00:00Z"`)
+	assert.Contains(t, string(raw), `"chain-name": "test"`)
+	assert.NotContains(t, string(raw), "previous-revisions")
+
+	// the earlier revisions of the chain are linked
+	writeRegistryChain(t, registry, "test-3", string(indented), nil, nil)
+	assert.Nil(t, WriteChainInfo(registry, "test-3", log.NewNopLogger()))
+	info := &ChainInfo{}
+	assert.Nil(t, utils.FromJSON(path.Join(registry, "test-3", "chain.json"), info))
+	assert.Equal(t, "test", info.ChainName)
+	assert.Equal(t, uint64(3), info.Revision)
+	assert.Equal(t, []string{"test-1"}, info.PreviousRevisions)
+}
@@ -0,0 +1,193 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jackzampolin/cosmos-registrar/pkg/utils"
+	"github.com/tendermint/tendermint/libs/log"
+	rpchttp "github.com/tendermint/tendermint/rpc/client/http"
+	"github.com/tendermint/tendermint/types"
+)
+
+// ErrForked is returned when a node disagrees with a checkpoint of its chain
+var ErrForked = errors.New("node is on a different fork")
+
+// Checkpoint pins the block of a chain at a height. Nodes reporting a
+// different block at that height are on a different fork.
+type Checkpoint struct {
+	Height    int64  `json:"height"`
+	AppHash   string `json:"app-hash,omitempty"`
+	BlockHash string `json:"block-hash,omitempty"`
+}
+
+// NewCheckpoint returns the checkpoint of a block
+func NewCheckpoint(sh types.SignedHeader) Checkpoint {
+	return Checkpoint{
+		Height:    sh.Header.Height,
+		AppHash:   sh.Header.AppHash.String(),
+		BlockHash: sh.Commit.BlockID.Hash.String(),
+	}
+}
+
+// Match checks a block against the checkpoint, it returns an error wrapping
+// ErrForked if the block is a different one. Hashes missing from the
+// checkpoint are not checked.
+func (cp Checkpoint) Match(sh types.SignedHeader) error {
+	if cp.AppHash != "" && !strings.EqualFold(cp.AppHash, sh.Header.AppHash.String()) {
+		return fmt.Errorf("%w: height %d has app hash %s, expected %s", ErrForked, cp.Height, sh.Header.AppHash, cp.AppHash)
+	}
+	if cp.BlockHash != "" && !strings.EqualFold(cp.BlockHash, sh.Commit.BlockID.Hash.String()) {
+		return fmt.Errorf("%w: height %d has block hash %s, expected %s", ErrForked, cp.Height, sh.Commit.BlockID.Hash, cp.BlockHash)
+	}
+	return nil
+}
+
+// Checkpoints are the checkpoints of a chain, sorted by height
+type Checkpoints []Checkpoint
+
+// Add returns the checkpoints with cp added. Adding a checkpoint for a height
+// that is already pinned to a different block is an error.
+func (cps Checkpoints) Add(cp Checkpoint) (Checkpoints, error) {
+	if cp.Height <= 0 {
+		return nil, fmt.Errorf("invalid checkpoint height %d", cp.Height)
+	}
+	if cp.AppHash == "" && cp.BlockHash == "" {
+		return nil, fmt.Errorf("the checkpoint at height %d has no hashes", cp.Height)
+	}
+	out := Checkpoints{}
+	for _, c := range cps {
+		if c.Height != cp.Height {
+			out = append(out, c)
+			continue
+		}
+		if (c.AppHash != "" && cp.AppHash != "" && !strings.EqualFold(c.AppHash, cp.AppHash)) ||
+			(c.BlockHash != "" && cp.BlockHash != "" && !strings.EqualFold(c.BlockHash, cp.BlockHash)) {
+			return nil, fmt.Errorf("height %d is already pinned to a different block", cp.Height)
+		}
+	}
+	out = append(out, cp)
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Height < out[j].Height })
+	return out, nil
+}
+
+// Verify checks a node against the checkpoints between the earliest and
+// the latest height it has. It returns an error wrapping ErrForked if the
+// node disagrees with any of them.
+func (cps Checkpoints) Verify(ctx context.Context, client *rpchttp.HTTP, earliest, latest int64) error {
+	for _, cp := range cps {
+		if cp.Height < earliest || cp.Height > latest {
+			continue
+		}
+		h := cp.Height
+		commit, err := client.Commit(ctx, &h)
+		if err != nil {
+			return fmt.Errorf("fetching the commit at checkpoint height %d: %s", h, err)
+		}
+		if err = cp.Match(commit.SignedHeader); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyNode checks the node at rpcAddress against the checkpoints
+func (cps Checkpoints) verifyNode(ctx context.Context, rpcAddress string) error {
+	if len(cps) == 0 {
+		return nil
+	}
+	client, err := Client(rpcAddress)
+	if err != nil {
+		return err
+	}
+	stat, err := client.Status(ctx)
+	if err != nil {
+		return err
+	}
+	return cps.Verify(ctx, client, stat.SyncInfo.EarliestBlockHeight, stat.SyncInfo.LatestBlockHeight)
+}
+
+// seedCheckpoints are the app hashes that were pinned in the code before the
+// checkpoints were kept in the registry
+var seedCheckpoints = map[string]Checkpoints{
+	"cosmoshub-4": {
+		{Height: 5200791, AppHash: "E3B0C44298FC1C149AFBF4C8996FB92427AE41E4649B934CA495991B7852B855"},
+		{Height: 6000000, AppHash: "DCBA58D3825AE20BA8FA836AAF386497D8D18A837F4B06D51D67BD372763D4FB"},
+		{Height: 6282992, AppHash: "101FCD443AAEDDE4904971810EC08EF44CA06C490E8C520483E02A55C6987FF7"},
+	},
+}
+
+// LoadCheckpoints loads the checkpoints of a chain. A chain without
+// checkpoints file has the seed checkpoints if it has any, else none.
+func LoadCheckpoints(basePath, chainID string) (cps Checkpoints, err error) {
+	repoRoot := repoDir{basePath, chainID}
+	cps = append(Checkpoints{}, seedCheckpoints[chainID]...)
+	if !utils.PathExists(repoRoot.checkpointsPath()) {
+		return
+	}
+	cps = Checkpoints{}
+	err = utils.FromJSON(repoRoot.checkpointsPath(), &cps)
+	return
+}
+
+// SeedCheckpoints writes the seed checkpoints of a chain that has no
+// checkpoints file yet, it returns true if the file was written
+func SeedCheckpoints(basePath, chainID string) (seeded bool, err error) {
+	repoRoot := repoDir{basePath, chainID}
+	cps, ok := seedCheckpoints[chainID]
+	if !ok || utils.PathExists(repoRoot.checkpointsPath()) {
+		return
+	}
+	if err = SaveCheckpoints(basePath, chainID, cps); err != nil {
+		return
+	}
+	return true, nil
+}
+
+// SaveCheckpoints writes the checkpoints of a chain
+func SaveCheckpoints(basePath, chainID string, cps Checkpoints) error {
+	repoRoot := repoDir{basePath, chainID}
+	return utils.ToJSON(repoRoot.checkpointsPath(), cps)
+}
+
+// FetchCheckpoint asks the peers for the block at height h and returns the
+// checkpoint of the block they agree on according to the policy
+func FetchCheckpoint(ctx context.Context, s *Scheduler, peers map[string]*Peer, h int64, policy AgreementPolicy, logger log.Logger) (cp Checkpoint, err error) {
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		cps = map[string]Checkpoint{}
+		lrr = NewLightRootResults()
+	)
+	for _, peer := range peers {
+		peer := peer
+		s.Go(ctx, &wg, func(ctx context.Context) {
+			client, err := Client(peer.Address)
+			if err != nil {
+				return
+			}
+			commit, err := client.Commit(ctx, &h)
+			if err != nil {
+				logger.Debug("error getting commit", "peer", peer.Address, "height", h, "error", err)
+				return
+			}
+			lrr.AddResult(peer.ID, NewLightRoot(commit.SignedHeader))
+			mu.Lock()
+			cps[peer.ID] = NewCheckpoint(commit.SignedHeader)
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	lr, _, err := lrr.Agree(policy)
+	if err != nil {
+		return cp, fmt.Errorf("peers did not agree on the block at height %d (%s): %s", h, policy, err)
+	}
+	return cps[lr.Peers[0]], nil
+}
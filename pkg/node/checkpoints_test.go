@@ -0,0 +1,146 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tendermint/tendermint/libs/log"
+)
+
+func TestCheckpointsAdd(t *testing.T) {
+	cps := Checkpoints{}
+	cps, err := cps.Add(Checkpoint{Height: 20, AppHash: "AA"})
+	assert.Nil(t, err)
+	cps, err = cps.Add(Checkpoint{Height: 10, BlockHash: "BB"})
+	assert.Nil(t, err)
+	// the same block, with more hashes
+	cps, err = cps.Add(Checkpoint{Height: 20, AppHash: "aa", BlockHash: "CC"})
+	assert.Nil(t, err)
+	assert.Equal(t, Checkpoints{{Height: 10, BlockHash: "BB"}, {Height: 20, AppHash: "aa", BlockHash: "CC"}}, cps)
+
+	_, err = cps.Add(Checkpoint{Height: 20, AppHash: "DD"})
+	assert.NotNil(t, err)
+	_, err = cps.Add(Checkpoint{Height: 30})
+	assert.NotNil(t, err)
+	_, err = cps.Add(Checkpoint{Height: 0, AppHash: "AA"})
+	assert.NotNil(t, err)
+}
+
+func TestCheckpointsVerify(t *testing.T) {
+	vals := newFakeValSet(4)
+	c := newFakeChain(t, "test-1", 10, func(h int64) fakeValSet { return vals })
+	n := newFakeNode(t, "aaaa", "test-1", 0)
+	n.Serve(c)
+	client, err := Client(n.Address())
+	assert.Nil(t, err)
+	good := NewCheckpoint(*c.blocks[5].SignedHeader)
+	wrongApp := Checkpoint{Height: 5, AppHash: "00"}
+	wrongBlock := Checkpoint{Height: 5, BlockHash: "00"}
+	ahead := Checkpoint{Height: 50, AppHash: "00"}
+
+	ctx := context.Background()
+	assert.Nil(t, Checkpoints{good, ahead}.Verify(ctx, client, 1, 10))
+	assert.True(t, errors.Is(Checkpoints{good, wrongApp}.Verify(ctx, client, 1, 10), ErrForked))
+	assert.True(t, errors.Is(Checkpoints{wrongBlock}.Verify(ctx, client, 1, 10), ErrForked))
+	// the node does not have the checkpoint height
+	assert.Nil(t, Checkpoints{wrongApp}.Verify(ctx, client, 6, 10))
+
+	p := n.Peer()
+	p.Contact(ctx, Checkpoints{good}, log.NewNopLogger())
+	assert.True(t, p.Reachable)
+	assert.False(t, p.Forked)
+	p.Contact(ctx, Checkpoints{wrongApp}, log.NewNopLogger())
+	assert.False(t, p.Reachable)
+	assert.True(t, p.Forked)
+}
+
+func TestCheckpointsExcludeForkedPeers(t *testing.T) {
+	vals := newFakeValSet(4)
+	c := newFakeChain(t, "test-1", 10, func(h int64) fakeValSet { return vals })
+	fork := newFakeChain(t, "test-1", 10, func(h int64) fakeValSet { return vals })
+	a, b, f := newFakeNode(t, "aaaa", "test-1", 0), newFakeNode(t, "bbbb", "test-1", 0), newFakeNode(t, "ffff", "test-1", 0)
+	a.Serve(c)
+	b.Serve(c)
+	f.Serve(fork)
+	a.Connect(b, f)
+	cps := Checkpoints{NewCheckpoint(*c.blocks[3].SignedHeader)}
+
+	s := NewScheduler(DefaultSchedulerOptions())
+	seed := a.Peer()
+	peers, _ := RefreshPeers(context.Background(), s, map[string]*Peer{seed.ID: seed},
+		CrawlOptions{MaxDepth: 1, MaxPeers: 10, Checkpoints: cps}, log.NewNopLogger())
+	assert.Len(t, peers, 3)
+	assert.True(t, peers["ffff"].Forked)
+	assert.False(t, peers["ffff"].Reachable)
+
+	opts := DefaultLightRootOptions()
+	opts.Checkpoints = cps
+	lr, dissenters, err := UpdateLightRoots(context.Background(), s, "test-1", peers, c.LightRoot(1), opts, log.NewNopLogger())
+	assert.Nil(t, err)
+	assert.Empty(t, dissenters)
+	assert.Equal(t, []string{"aaaa", "bbbb"}, lr.Peers)
+
+	// a peer forking after the crawl is flagged by the update
+	peers = map[string]*Peer{"aaaa": a.Peer(), "bbbb": b.Peer(), "ffff": f.Peer()}
+	lr, _, err = UpdateLightRoots(context.Background(), s, "test-1", peers, c.LightRoot(1), opts, log.NewNopLogger())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"aaaa", "bbbb"}, lr.Peers)
+	assert.True(t, peers["ffff"].Forked)
+
+	cp, err := FetchCheckpoint(context.Background(), s, map[string]*Peer{"aaaa": a.Peer(), "bbbb": b.Peer()}, 7, DefaultAgreementPolicy(), log.NewNopLogger())
+	assert.Nil(t, err)
+	assert.Equal(t, NewCheckpoint(*c.blocks[7].SignedHeader), cp)
+}
+
+func TestDumpInfoCheckpoints(t *testing.T) {
+	vals := newFakeValSet(4)
+	c := newFakeChain(t, "test-1", 5, func(h int64) fakeValSet { return vals })
+	n := newFakeNode(t, "aaaa", "test-1", 0)
+	n.Serve(c)
+	n.ServeGenesis([]byte(`{"chain_id":"test-1","genesis_time":"2021-06-01T12:00:00Z"}`), 0)
+
+	registry := t.TempDir()
+	assert.Nil(t, os.MkdirAll(repoDir{registry, "test-1"}.chainPath(), 0700))
+	assert.Nil(t, SaveCheckpoints(registry, "test-1", Checkpoints{{Height: 2, AppHash: "00"}}))
+	assert.NotNil(t, DumpInfo(registry, "test-1", n.Address(), "", nil, log.NewNopLogger()))
+
+	assert.Nil(t, SaveCheckpoints(registry, "test-1", Checkpoints{NewCheckpoint(*c.blocks[2].SignedHeader)}))
+	assert.Nil(t, DumpInfo(registry, "test-1", n.Address(), "", nil, log.NewNopLogger()))
+	cps, err := LoadCheckpoints(registry, "test-1")
+	assert.Nil(t, err)
+	assert.Len(t, cps, 1)
+}
+
+func TestSeedCheckpoints(t *testing.T) {
+	registry := t.TempDir()
+	assert.Nil(t, os.MkdirAll(repoDir{registry, "cosmoshub-4"}.chainPath(), 0700))
+	assert.Nil(t, os.MkdirAll(repoDir{registry, "test-1"}.chainPath(), 0700))
+
+	// chains without checkpoints file get the seed checkpoints
+	cps, err := LoadCheckpoints(registry, "cosmoshub-4")
+	assert.Nil(t, err)
+	assert.Equal(t, seedCheckpoints["cosmoshub-4"], cps)
+	cps, err = LoadCheckpoints(registry, "test-1")
+	assert.Nil(t, err)
+	assert.Empty(t, cps)
+
+	seeded, err := SeedCheckpoints(registry, "test-1")
+	assert.Nil(t, err)
+	assert.False(t, seeded)
+	seeded, err = SeedCheckpoints(registry, "cosmoshub-4")
+	assert.Nil(t, err)
+	assert.True(t, seeded)
+
+	// the checkpoints file replaces the seed
+	cp := Checkpoint{Height: 7000000, AppHash: "AA"}
+	assert.Nil(t, SaveCheckpoints(registry, "cosmoshub-4", Checkpoints{cp}))
+	seeded, err = SeedCheckpoints(registry, "cosmoshub-4")
+	assert.Nil(t, err)
+	assert.False(t, seeded)
+	cps, err = LoadCheckpoints(registry, "cosmoshub-4")
+	assert.Nil(t, err)
+	assert.Equal(t, Checkpoints{cp}, cps)
+}
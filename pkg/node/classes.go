@@ -0,0 +1,85 @@
+package node
+
+import (
+	"sort"
+
+	"github.com/jackzampolin/cosmos-registrar/pkg/utils"
+)
+
+// The classes of the peers, a reachable peer is either archive or pruned and
+// can be syncing or lagging as well
+const (
+	// PeerArchive is a peer that has the blocks since the initial height
+	PeerArchive = "archive"
+	// PeerPruned is a peer that only has the blocks since its earliest height
+	PeerPruned = "pruned"
+	// PeerSyncing is a peer that is catching up with the chain
+	PeerSyncing = "syncing"
+	// PeerLagging is a peer too many blocks behind the other peers
+	PeerLagging = "lagging"
+)
+
+// ClassifyOptions are the references the peers are classified against
+type ClassifyOptions struct {
+	// InitialHeight is the first height of the chain, peers that have it
+	// are archive nodes
+	InitialHeight int64
+	// MaxLag is the number of blocks a peer can be behind the median height
+	// of the peers before it is lagging, 0 never flags peers as lagging
+	MaxLag int64
+}
+
+// DefaultClassifyOptions returns the classification references used when
+// none are configured
+func DefaultClassifyOptions() ClassifyOptions {
+	return ClassifyOptions{
+		InitialHeight: 1,
+		MaxLag:        50,
+	}
+}
+
+// HasClass tells if the peer is of a class
+func (p Peer) HasClass(class string) bool {
+	return utils.ContainsStr(&p.Classes, class)
+}
+
+// ClassifyPeers sets the classes of the reachable peers from the heights
+// they reported when they were last contacted. Lagging is relative to the
+// median latest height of the reachable peers that are not syncing. The
+// classes of the peers that are not reachable are left as they are.
+func ClassifyPeers(peers map[string]*Peer, opts ClassifyOptions) {
+	heights := []int64{}
+	for _, p := range peers {
+		if p.rpcUsable() && !p.CatchingUp {
+			heights = append(heights, p.LastContactHeight)
+		}
+	}
+	median := medianHeight(heights)
+
+	for _, p := range peers {
+		if !p.rpcUsable() {
+			continue
+		}
+		p.Classes = []string{PeerPruned}
+		if p.EarliestHeight <= opts.InitialHeight {
+			p.Classes[0] = PeerArchive
+		}
+		if p.CatchingUp {
+			p.Classes = append(p.Classes, PeerSyncing)
+		}
+		if opts.MaxLag > 0 && median-p.LastContactHeight > opts.MaxLag {
+			p.Classes = append(p.Classes, PeerLagging)
+		}
+	}
+}
+
+// medianHeight returns the median of the heights, 0 if there are none.
+// The lower of the two middle heights is taken for an even number of them.
+func medianHeight(heights []int64) int64 {
+	if len(heights) == 0 {
+		return 0
+	}
+	sorted := append([]int64{}, heights...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[(len(sorted)-1)/2]
+}
@@ -0,0 +1,61 @@
+package node
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tendermint/tendermint/libs/log"
+)
+
+func TestClassifyPeers(t *testing.T) {
+	peers := map[string]*Peer{
+		"archive": {Address: "http://a:26657", Reachable: true, EarliestHeight: 1, LastContactHeight: 1000},
+		"pruned":  {Address: "http://p:26657", Reachable: true, EarliestHeight: 900, LastContactHeight: 1001},
+		"lagging": {Address: "http://l:26657", Reachable: true, EarliestHeight: 500, LastContactHeight: 900},
+		"syncing": {Address: "http://s:26657", Reachable: true, EarliestHeight: 1, LastContactHeight: 10, CatchingUp: true},
+		"down":    {Address: "http://d:26657", Reachable: false, LastContactHeight: 10, Classes: []string{PeerArchive}},
+		// peers without rpc don't report heights
+		"p2p-only": {Reachable: true, P2PAddr: "10.0.0.1:26656", P2PReachable: true},
+	}
+	ClassifyPeers(peers, ClassifyOptions{InitialHeight: 1, MaxLag: 50})
+	assert.Equal(t, []string{PeerArchive}, peers["archive"].Classes)
+	assert.Equal(t, []string{PeerPruned}, peers["pruned"].Classes)
+	assert.Equal(t, []string{PeerPruned, PeerLagging}, peers["lagging"].Classes)
+	// syncing peers are not part of the median
+	assert.Equal(t, []string{PeerArchive, PeerSyncing, PeerLagging}, peers["syncing"].Classes)
+	assert.Equal(t, []string{PeerArchive}, peers["down"].Classes)
+	assert.Empty(t, peers["p2p-only"].Classes)
+	assert.True(t, peers["lagging"].HasClass(PeerLagging))
+	assert.False(t, peers["pruned"].HasClass(PeerLagging))
+
+	// chains that start at a later height, no lag limit
+	ClassifyPeers(peers, ClassifyOptions{InitialHeight: 500})
+	assert.Equal(t, []string{PeerArchive}, peers["lagging"].Classes)
+	assert.Equal(t, []string{PeerPruned}, peers["pruned"].Classes)
+}
+
+func TestMedianHeight(t *testing.T) {
+	assert.Equal(t, int64(0), medianHeight(nil))
+	assert.Equal(t, int64(5), medianHeight([]int64{5}))
+	assert.Equal(t, int64(5), medianHeight([]int64{9, 5, 1}))
+	assert.Equal(t, int64(5), medianHeight([]int64{9, 5, 7, 1}))
+}
+
+func TestContactHeights(t *testing.T) {
+	n := newFakeNode(t, "aaaa", "test-1", 100)
+	n.earliest = 40
+	p := n.Peer()
+	p.Contact(context.Background(), nil, log.NewNopLogger())
+	assert.True(t, p.Reachable)
+	assert.Equal(t, int64(40), p.EarliestHeight)
+	assert.Equal(t, int64(100), p.LastContactHeight)
+	assert.False(t, p.CatchingUp)
+
+	s := NewPeerStore(nil, DefaultPeerStoreOptions())
+	s.Merge(map[string]*Peer{p.ID: p}, []string{p.ID}, p.LastContactDate)
+	s.Classify(DefaultClassifyOptions())
+	stored, _ := s.Get(p.ID)
+	assert.Equal(t, int64(40), stored.EarliestHeight)
+	assert.Equal(t, []string{PeerPruned}, stored.Classes)
+}
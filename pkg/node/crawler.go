@@ -0,0 +1,308 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tendermint/tendermint/libs/log"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+)
+
+// CrawlOptions bounds how far RefreshPeers walks the network
+type CrawlOptions struct {
+	// MaxDepth is the number of hops followed from the known peers,
+	// 0 only contacts the known peers
+	MaxDepth int
+	// MaxPeers is the maximum number of distinct peers contacted in a crawl
+	MaxPeers int
+	// Checkpoints are the pinned blocks of the chain, peers disagreeing with
+	// them are flagged as forked and not crawled
+	Checkpoints Checkpoints
+	// VerifyIdentity verifies the node ID of the reachable peers with a p2p
+	// handshake, impersonated peers are not reachable and not crawled
+	VerifyIdentity bool
+}
+
+// DefaultCrawlOptions returns the crawl limits used when none are configured
+func DefaultCrawlOptions() CrawlOptions {
+	return CrawlOptions{
+		MaxDepth: 2,
+		MaxPeers: 250,
+	}
+}
+
+// crawler walks /net_info breadth first starting from a set of known peers.
+// Every peer is contacted at most once, identified by its node ID.
+type crawler struct {
+	opts   CrawlOptions
+	sched  *Scheduler
+	np     *NodePool
+	logger log.Logger
+
+	mu   sync.Mutex
+	seen map[string]bool
+	// contacted are the peers the crawl actually tried to reach
+	contacted map[string]bool
+}
+
+func newCrawler(s *Scheduler, opts CrawlOptions, logger log.Logger) *crawler {
+	return &crawler{
+		opts:      opts,
+		sched:     s,
+		np:        NewNodePool(),
+		logger:    logger,
+		seen:      make(map[string]bool),
+		contacted: make(map[string]bool),
+	}
+}
+
+// target is a peer to visit together with the rpc addresses it may answer on,
+// peers without rpc addresses are only checked on their p2p address
+type target struct {
+	peer  *Peer
+	addrs []string
+}
+
+// reserve marks a node ID as visited, it returns false if the node was
+// already visited or the crawl reached the maximum number of peers
+func (c *crawler) reserve(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.seen[id] {
+		return false
+	}
+	if c.opts.MaxPeers > 0 && len(c.seen) >= c.opts.MaxPeers {
+		return false
+	}
+	c.seen[id] = true
+	return true
+}
+
+// crawl visits the known peers and then, one hop at a time, the peers they
+// report until MaxDepth or MaxPeers is reached, or ctx is done
+func (c *crawler) crawl(ctx context.Context, peers map[string]*Peer) {
+	level := make([]target, 0, len(peers))
+	for _, p := range peers {
+		if !c.reserve(p.ID) {
+			continue
+		}
+		t := target{peer: p}
+		if p.Address != "" {
+			t.addrs = []string{p.Address}
+		}
+		level = append(level, t)
+	}
+
+	for depth := 0; len(level) > 0 && ctx.Err() == nil; depth++ {
+		c.logger.Debug("crawling peers", "depth", depth, "peers", len(level))
+		var (
+			wg   sync.WaitGroup
+			mu   sync.Mutex
+			next []target
+		)
+		for _, t := range level {
+			wg.Add(1)
+			go func(t target) {
+				defer wg.Done()
+				found := c.visit(ctx, t, depth)
+				mu.Lock()
+				next = append(next, found...)
+				mu.Unlock()
+			}(t)
+		}
+		wg.Wait()
+		level = next
+	}
+}
+
+// contact tries the addresses of a target in order and keeps the first one
+// that answers as the peer address
+func (c *crawler) contact(ctx context.Context, t target) bool {
+	if len(t.addrs) == 0 {
+		return c.contactP2POnly(ctx, t.peer)
+	}
+	for _, addr := range t.addrs {
+		err := c.sched.Do(ctx, func(ctx context.Context) {
+			t.peer.Address = addr
+			t.peer.Contact(ctx, c.opts.Checkpoints, c.logger)
+		})
+		if err != nil {
+			return false
+		}
+		c.markContacted(t.peer.ID)
+		if t.peer.Reachable {
+			return c.verifyIdentity(ctx, t.peer)
+		}
+		if t.peer.Forked {
+			return false
+		}
+	}
+	return false
+}
+
+// contactP2POnly checks that a peer without rpc accepts p2p connections, the
+// peer is reachable if it does
+func (c *crawler) contactP2POnly(ctx context.Context, p *Peer) bool {
+	if err := c.sched.Do(ctx, p.checkP2P); err != nil {
+		return false
+	}
+	c.markContacted(p.ID)
+	p.Reachable, p.UpdatedAt = p.P2PReachable, time.Now()
+	if !p.Reachable {
+		return false
+	}
+	return c.verifyIdentity(ctx, p)
+}
+
+// markContacted records that the crawl tried to reach a peer
+func (c *crawler) markContacted(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.contacted[id] = true
+}
+
+// verifyIdentity verifies the node ID of a reachable peer if the options ask
+// for it, it returns false if the peer is impersonated
+func (c *crawler) verifyIdentity(ctx context.Context, p *Peer) bool {
+	if !c.opts.VerifyIdentity || !p.P2PReachable {
+		return true
+	}
+	var err error
+	if serr := c.sched.Do(ctx, func(ctx context.Context) {
+		err = p.VerifyIdentity(ctx)
+	}); serr != nil {
+		return false
+	}
+	if err != nil {
+		c.logger.Debug("could not verify the peer identity", "peer", p.ID, "error", err)
+		return true
+	}
+	if p.Identity == IdentityImpersonated {
+		c.logger.Info("peer is impersonated", "peer", p.ID, "p2p-addr", p.P2PAddr)
+		p.Reachable = false
+		return false
+	}
+	return true
+}
+
+// visit contacts a peer and, if it is reachable and the crawl can go deeper,
+// returns the peers it reports that have not been visited yet. Peers without
+// rpc are recorded but not crawled.
+func (c *crawler) visit(ctx context.Context, t target, depth int) (found []target) {
+	p := t.peer
+	if !c.contact(ctx, t) {
+		// forked and impersonated peers are kept to publish the flag
+		if p.Forked || p.Identity == IdentityImpersonated {
+			c.np.AddNode(p.ID, p)
+		}
+		return
+	}
+	c.np.AddNode(p.ID, p)
+	if depth >= c.opts.MaxDepth || p.Address == "" {
+		return
+	}
+
+	client, err := Client(p.Address)
+	if err != nil {
+		c.logger.Error("error creating tendermint client", "peer", p.Address, "error", err)
+		return
+	}
+	var (
+		netInfo *ctypes.ResultNetInfo
+		netErr  error
+	)
+	if err = c.sched.Do(ctx, func(ctx context.Context) {
+		netInfo, netErr = client.NetInfo(ctx)
+	}); err != nil {
+		return
+	}
+	if netErr != nil {
+		c.logger.Debug("GET /net_info failed", "peer", p.Address, "error", netErr)
+		return
+	}
+	c.logger.Debug("GET /net_info", "rpc-addr", p.Address, "peers", len(netInfo.Peers))
+
+	for _, np := range netInfo.Peers {
+		id := string(np.NodeInfo.DefaultNodeID)
+		addrs := rpcCandidates(np)
+		p2pAddr := p2pAddress(np.NodeInfo.ListenAddr, np.RemoteIP)
+		if len(addrs) == 0 && p2pAddr == "" {
+			c.logger.Debug("peer exposes neither rpc nor p2p", "peer", id)
+			continue
+		}
+		if !c.reserve(id) {
+			continue
+		}
+		found = append(found, target{
+			peer: &Peer{
+				ID:           id,
+				IntroducedBy: p.ID,
+				UpdatedAt:    time.Now(),
+				P2PAddr:      p2pAddr,
+				remoteIP:     np.RemoteIP,
+			},
+			addrs: addrs,
+		})
+	}
+	return
+}
+
+// rpcCandidates returns the addresses a peer reported by /net_info may serve
+// rpc on, built from the rpc listen address it advertises. Placeholder hosts
+// (0.0.0.0, localhost, ...) are resolved against the p2p listen address and
+// then against the ip the peer was seen from. Nodes that do not advertise an
+// rpc address, or only listen on a unix socket, return no candidates.
+func rpcCandidates(p ctypes.Peer) (addrs []string) {
+	host, port, ok := splitListenAddr(p.NodeInfo.Other.RPCAddress)
+	if !ok {
+		return
+	}
+	if isPlaceholderHost(host) {
+		host = p.RemoteIP
+		if lHost, _, ok := splitListenAddr(p.NodeInfo.ListenAddr); ok && !isPlaceholderHost(lHost) {
+			host = lHost
+		}
+	}
+	if host == "" {
+		return
+	}
+	if port == "" {
+		port = "26657"
+	}
+	hostPort := net.JoinHostPort(host, port)
+	return []string{
+		fmt.Sprintf("https://%s", hostPort),
+		fmt.Sprintf("http://%s", hostPort),
+	}
+}
+
+// splitListenAddr splits a tendermint listen address (eg. tcp://0.0.0.0:26657)
+// into host and port
+func splitListenAddr(addr string) (host, port string, ok bool) {
+	addr = strings.TrimSpace(addr)
+	if addr == "" || strings.HasPrefix(addr, "unix://") {
+		return
+	}
+	if i := strings.Index(addr, "://"); i >= 0 {
+		addr = addr[i+3:]
+	}
+	addr = strings.TrimSuffix(addr, "/")
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		// no port in the address
+		host, port = strings.Trim(addr, "[]"), ""
+	}
+	return host, port, true
+}
+
+func isPlaceholderHost(host string) bool {
+	switch host {
+	case "", "0.0.0.0", "::", "127.0.0.1", "::1", "localhost":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tendermint/tendermint/libs/log"
+	"github.com/tendermint/tendermint/p2p"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+)
+
+func crawlFakes(peers map[string]*Peer, opts CrawlOptions) map[string]*Peer {
+	crawled, _ := RefreshPeers(context.Background(), NewScheduler(DefaultSchedulerOptions()), peers, opts, log.NewNopLogger())
+	return crawled
+}
+
+func TestCrawlDepth(t *testing.T) {
+	a := newFakeNode(t, "aaaa", "test-1", 10)
+	b := newFakeNode(t, "bbbb", "test-1", 10)
+	c := newFakeNode(t, "cccc", "test-1", 10)
+	d := newFakeNode(t, "dddd", "test-1", 10)
+	a.Connect(b)
+	b.Connect(a, c)
+	c.Connect(b, d)
+
+	tests := []struct {
+		depth int
+		want  []string
+	}{
+		{0, []string{"aaaa"}},
+		{1, []string{"aaaa", "bbbb"}},
+		{2, []string{"aaaa", "bbbb", "cccc"}},
+		{5, []string{"aaaa", "bbbb", "cccc", "dddd"}},
+	}
+	for _, tt := range tests {
+		seed := a.Peer()
+		got := crawlFakes(map[string]*Peer{seed.ID: seed}, CrawlOptions{MaxDepth: tt.depth, MaxPeers: 100})
+		ids := []string{}
+		for id := range got {
+			ids = append(ids, id)
+		}
+		assert.ElementsMatch(t, tt.want, ids, "depth %d", tt.depth)
+	}
+
+	seed := a.Peer()
+	got := crawlFakes(map[string]*Peer{seed.ID: seed}, CrawlOptions{MaxDepth: 5, MaxPeers: 100})
+	assert.Equal(t, "", got["aaaa"].IntroducedBy)
+	assert.Equal(t, "aaaa", got["bbbb"].IntroducedBy)
+	assert.Equal(t, "bbbb", got["cccc"].IntroducedBy)
+	assert.Equal(t, "cccc", got["dddd"].IntroducedBy)
+	assert.Equal(t, d.Address(), got["dddd"].Address)
+}
+
+func TestCrawlMaxPeersAndDedup(t *testing.T) {
+	a := newFakeNode(t, "aaaa", "test-1", 10)
+	b := newFakeNode(t, "bbbb", "test-1", 10)
+	c := newFakeNode(t, "cccc", "test-1", 10)
+	d := newFakeNode(t, "dddd", "test-1", 10)
+	a.Connect(b, c)
+	b.Connect(a, c, d)
+	c.Connect(a, b, d)
+
+	seed := a.Peer()
+	got := crawlFakes(map[string]*Peer{seed.ID: seed}, CrawlOptions{MaxDepth: 5, MaxPeers: 100})
+	assert.Len(t, got, 4)
+	assert.Contains(t, []string{"bbbb", "cccc"}, got["dddd"].IntroducedBy)
+
+	seed = a.Peer()
+	got, contacted := RefreshPeers(context.Background(), NewScheduler(DefaultSchedulerOptions()), map[string]*Peer{seed.ID: seed}, CrawlOptions{MaxDepth: 5, MaxPeers: 2}, log.NewNopLogger())
+	assert.Len(t, got, 2)
+	assert.Contains(t, got, "aaaa")
+	// the peers left out by the limit are not contacted
+	assert.Len(t, contacted, 2)
+	assert.Contains(t, contacted, "aaaa")
+}
+
+func TestCrawlUnreachableSeed(t *testing.T) {
+	a := newFakeNode(t, "aaaa", "test-1", 10)
+	down := &Peer{ID: "ffff", Address: "http://127.0.0.1:1"}
+	seed := a.Peer()
+	got, contacted := RefreshPeers(context.Background(), NewScheduler(DefaultSchedulerOptions()), map[string]*Peer{seed.ID: seed, down.ID: down}, DefaultCrawlOptions(), log.NewNopLogger())
+	assert.Len(t, got, 1)
+	assert.False(t, down.Reachable)
+	assert.Equal(t, []string{"aaaa", "ffff"}, contacted)
+}
+
+func TestCrawlNetInfoFails(t *testing.T) {
+	a := newFakeNode(t, "aaaa", "test-1", 10)
+	b := newFakeNode(t, "bbbb", "test-1", 10)
+	c := newFakeNode(t, "cccc", "test-1", 10)
+	a.Connect(b)
+	b.Connect(c)
+	b.netInfoErr = fmt.Errorf("net_info is disabled")
+
+	seed := a.Peer()
+	got := crawlFakes(map[string]*Peer{seed.ID: seed}, CrawlOptions{MaxDepth: 5, MaxPeers: 100})
+	// b is reachable but its peers cannot be listed
+	assert.Len(t, got, 2)
+	assert.True(t, got["bbbb"].Reachable)
+	assert.NotContains(t, got, "cccc")
+}
+
+func TestCrawlCanceled(t *testing.T) {
+	a := newFakeNode(t, "aaaa", "test-1", 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	seed := a.Peer()
+	got, contacted := RefreshPeers(ctx, NewScheduler(DefaultSchedulerOptions()), map[string]*Peer{seed.ID: seed}, DefaultCrawlOptions(), log.NewNopLogger())
+	assert.Len(t, got, 0)
+	assert.Empty(t, contacted)
+}
+
+func TestRPCCandidates(t *testing.T) {
+	tests := []struct {
+		name       string
+		rpcAddr    string
+		listenAddr string
+		remoteIP   string
+		want       []string
+	}{
+		{"placeholder", "tcp://0.0.0.0:26657", "tcp://0.0.0.0:26656", "1.2.3.4", []string{"https://1.2.3.4:26657", "http://1.2.3.4:26657"}},
+		{"loopback", "tcp://127.0.0.1:36657", "tcp://0.0.0.0:26656", "1.2.3.4", []string{"https://1.2.3.4:36657", "http://1.2.3.4:36657"}},
+		{"external listen address", "tcp://0.0.0.0:26657", "tcp://node.example.com:26656", "1.2.3.4", []string{"https://node.example.com:26657", "http://node.example.com:26657"}},
+		{"advertised host", "tcp://rpc.example.com:443", "tcp://0.0.0.0:26656", "1.2.3.4", []string{"https://rpc.example.com:443", "http://rpc.example.com:443"}},
+		{"ipv6", "tcp://[::]:26657", "", "2001:db8::1", []string{"https://[2001:db8::1]:26657", "http://[2001:db8::1]:26657"}},
+		{"no port", "tcp://0.0.0.0", "", "1.2.3.4", []string{"https://1.2.3.4:26657", "http://1.2.3.4:26657"}},
+		{"no rpc", "", "tcp://0.0.0.0:26656", "1.2.3.4", nil},
+		{"unix socket", "unix:///tmp/rpc.sock", "tcp://0.0.0.0:26656", "1.2.3.4", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := ctypes.Peer{
+				NodeInfo: p2p.DefaultNodeInfo{
+					ListenAddr: tt.listenAddr,
+					Other:      p2p.DefaultNodeInfoOther{RPCAddress: tt.rpcAddr},
+				},
+				RemoteIP: tt.remoteIP,
+			}
+			assert.Equal(t, tt.want, rpcCandidates(p))
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tendermint/tendermint/crypto/tmhash"
+	tmproto "github.com/tendermint/tendermint/proto/tendermint/types"
+	tmversion "github.com/tendermint/tendermint/proto/tendermint/version"
+	"github.com/tendermint/tendermint/types"
+	"github.com/tendermint/tendermint/version"
+)
+
+// fakeValSet is a validator set together with its private keys
+type fakeValSet struct {
+	vals  *types.ValidatorSet
+	privs []types.PrivValidator
+}
+
+func newFakeValSet(n int) fakeValSet {
+	vals, privs := types.RandValidatorSet(n, 10)
+	return fakeValSet{vals, privs}
+}
+
+// fakeChain is a synthetic chain of signed light blocks
+type fakeChain struct {
+	chainID string
+	blocks  map[int64]*types.LightBlock
+}
+
+// newFakeChain signs the blocks from 1 to height, valsAt returns the validator
+// set that signs the block at each height. Block times are one second apart
+// and the last block is a minute old.
+func newFakeChain(t *testing.T, chainID string, height int64, valsAt func(h int64) fakeValSet) *fakeChain {
+	c := &fakeChain{chainID: chainID, blocks: map[int64]*types.LightBlock{}}
+	start := time.Now().Add(-time.Minute - time.Duration(height)*time.Second).UTC().Round(0)
+	lastBlockID := types.BlockID{}
+	for h := int64(1); h <= height; h++ {
+		vs, next := valsAt(h), valsAt(h+1)
+		header := &types.Header{
+			Version:            tmversion.Consensus{Block: version.BlockProtocol},
+			ChainID:            chainID,
+			Height:             h,
+			Time:               start.Add(time.Duration(h) * time.Second),
+			LastBlockID:        lastBlockID,
+			ValidatorsHash:     vs.vals.Hash(),
+			NextValidatorsHash: next.vals.Hash(),
+			ConsensusHash:      tmhash.Sum([]byte("consensus")),
+			AppHash:            tmhash.Sum([]byte{byte(h)}),
+			ProposerAddress:    vs.vals.Proposer.Address,
+		}
+		blockID := types.BlockID{
+			Hash:          header.Hash(),
+			PartSetHeader: types.PartSetHeader{Total: 1, Hash: tmhash.Sum(header.Hash())},
+		}
+		voteSet := types.NewVoteSet(chainID, h, 0, tmproto.PrecommitType, vs.vals)
+		commit, err := types.MakeCommit(blockID, h, 0, voteSet, vs.privs, header.Time.Add(time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.blocks[h] = &types.LightBlock{
+			SignedHeader: &types.SignedHeader{Header: header, Commit: commit},
+			ValidatorSet: vs.vals,
+		}
+		lastBlockID = blockID
+	}
+	return c
+}
+
+// Height is the latest height of the chain
+func (c *fakeChain) Height() int64 { return int64(len(c.blocks)) }
+
+// LightRoot returns the light root at height h
+func (c *fakeChain) LightRoot(h int64) *LightRoot {
+	return NewLightRoot(*c.blocks[h].SignedHeader)
+}
@@ -0,0 +1,287 @@
+package node
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	abci "github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/crypto"
+	"github.com/tendermint/tendermint/libs/log"
+	"github.com/tendermint/tendermint/p2p"
+	"github.com/tendermint/tendermint/p2p/conn"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+	rpcserver "github.com/tendermint/tendermint/rpc/jsonrpc/server"
+	rpctypes "github.com/tendermint/tendermint/rpc/jsonrpc/types"
+	"github.com/tendermint/tendermint/types"
+)
+
+// fakeNode is an in-process tendermint rpc endpoint serving the routes used
+// by the registrar
+type fakeNode struct {
+	mu      sync.Mutex
+	id      string
+	chainID string
+	height  int64
+	// earliest is the lowest height the node has
+	earliest int64
+	// catchingUp is reported by /status
+	catchingUp bool
+	peers      []*fakeNode
+	chain      *fakeChain
+	// genesis is served in chunks of chunkSize bytes, /genesis_chunked is
+	// not supported if chunkSize is 0
+	genesis   []byte
+	chunkSize int
+	// version is the software reported by /abci_info and /status
+	version NodeVersion
+	// listenAddr is the p2p listen address in the node info
+	listenAddr string
+	// netInfoErr is returned by /net_info instead of the peers
+	netInfoErr error
+	// noRPC leaves the rpc address out of the node info, like p2p only
+	// sentries and seeds do
+	noRPC bool
+
+	srv *httptest.Server
+}
+
+func newFakeNode(t *testing.T, id, chainID string, height int64) *fakeNode {
+	n := &fakeNode{id: id, chainID: chainID, height: height, listenAddr: "tcp://0.0.0.0:26656", version: NodeVersion{
+		App:        "FakeApp",
+		Version:    "v1.0.0",
+		AppVersion: 1,
+		Tendermint: "0.34.9",
+	}}
+	mux := http.NewServeMux()
+	rpcserver.RegisterRPCFuncs(mux, map[string]*rpcserver.RPCFunc{
+		"status":          rpcserver.NewRPCFunc(n.status, ""),
+		"abci_info":       rpcserver.NewRPCFunc(n.abciInfo, ""),
+		"net_info":        rpcserver.NewRPCFunc(n.netInfo, ""),
+		"commit":          rpcserver.NewRPCFunc(n.commit, "height"),
+		"validators":      rpcserver.NewRPCFunc(n.validators, "height,page,per_page"),
+		"genesis":         rpcserver.NewRPCFunc(n.genesisDoc, ""),
+		"genesis_chunked": rpcserver.NewRPCFunc(n.genesisChunked, "chunk"),
+	}, log.NewNopLogger())
+	n.srv = httptest.NewServer(mux)
+	t.Cleanup(n.srv.Close)
+	return n
+}
+
+// Address is the rpc address of the node
+func (n *fakeNode) Address() string { return n.srv.URL }
+
+// Peer returns the registrar record of the node, reachable as a crawl finds
+// it
+func (n *fakeNode) Peer() *Peer { return &Peer{ID: n.id, Address: n.Address(), Reachable: true} }
+
+// Serve makes the node serve the blocks of a chain, its latest height
+// becomes the chain height
+func (n *fakeNode) Serve(c *fakeChain) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.chain = c
+	n.height, n.earliest = c.Height(), 1
+}
+
+// ServeGenesis makes the node serve a genesis, in chunks of chunkSize bytes
+// if chunkSize is not 0
+func (n *fakeNode) ServeGenesis(genesis []byte, chunkSize int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.genesis, n.chunkSize = genesis, chunkSize
+}
+
+// SetVersion changes the software the node reports
+func (n *fakeNode) SetVersion(v NodeVersion) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.version = v
+}
+
+// ListenP2P makes the node accept tcp connections on a p2p port, the
+// listener is returned to stop it. If key is not nil the connections go
+// through the p2p handshake with it, otherwise they are closed right away.
+func (n *fakeNode) ListenP2P(t *testing.T, key crypto.PrivKey) net.Listener {
+	l := listenP2P(t, key)
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.listenAddr = fmt.Sprintf("tcp://0.0.0.0:%s", port)
+	return l
+}
+
+// listenP2P is an in-process p2p endpoint on localhost
+func listenP2P(t *testing.T, key crypto.PrivKey) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				if key != nil {
+					conn.MakeSecretConnection(c, key)
+				}
+			}()
+		}
+	}()
+	return l
+}
+
+// Connect makes each node report the others in /net_info
+func (n *fakeNode) Connect(others ...*fakeNode) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.peers = append(n.peers, others...)
+}
+
+func (n *fakeNode) nodeInfo() p2p.DefaultNodeInfo {
+	u, _ := url.Parse(n.srv.URL)
+	info := p2p.DefaultNodeInfo{
+		DefaultNodeID: p2p.ID(n.id),
+		ListenAddr:    n.listenAddr,
+		Network:       n.chainID,
+		Version:       n.version.Tendermint,
+		Other: p2p.DefaultNodeInfoOther{
+			RPCAddress: fmt.Sprintf("tcp://0.0.0.0:%s", u.Port()),
+		},
+	}
+	if n.noRPC {
+		info.Other.RPCAddress = ""
+	}
+	return info
+}
+
+func (n *fakeNode) status(ctx *rpctypes.Context) (*ctypes.ResultStatus, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return &ctypes.ResultStatus{
+		NodeInfo: n.nodeInfo(),
+		SyncInfo: ctypes.SyncInfo{LatestBlockHeight: n.height, EarliestBlockHeight: n.earliest, CatchingUp: n.catchingUp},
+	}, nil
+}
+
+func (n *fakeNode) abciInfo(ctx *rpctypes.Context) (*ctypes.ResultABCIInfo, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return &ctypes.ResultABCIInfo{Response: abci.ResponseInfo{
+		Data:            n.version.App,
+		Version:         n.version.Version,
+		AppVersion:      n.version.AppVersion,
+		LastBlockHeight: n.height,
+	}}, nil
+}
+
+func (n *fakeNode) netInfo(ctx *rpctypes.Context) (*ctypes.ResultNetInfo, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.netInfoErr != nil {
+		return nil, n.netInfoErr
+	}
+	res := &ctypes.ResultNetInfo{Listening: true}
+	for _, p := range n.peers {
+		res.Peers = append(res.Peers, ctypes.Peer{
+			NodeInfo: p.nodeInfo(),
+			RemoteIP: "127.0.0.1",
+		})
+	}
+	res.NPeers = len(res.Peers)
+	return res, nil
+}
+
+func (n *fakeNode) lightBlock(height *int64) (*types.LightBlock, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.chain == nil {
+		return nil, fmt.Errorf("no chain")
+	}
+	h := n.height
+	if height != nil {
+		h = *height
+	}
+	lb, ok := n.chain.blocks[h]
+	if !ok {
+		return nil, fmt.Errorf("height %d must be less than or equal to the current blockchain height %d", h, n.height)
+	}
+	return lb, nil
+}
+
+func (n *fakeNode) commit(ctx *rpctypes.Context, height *int64) (*ctypes.ResultCommit, error) {
+	lb, err := n.lightBlock(height)
+	if err != nil {
+		return nil, err
+	}
+	return ctypes.NewResultCommit(lb.Header, lb.Commit, true), nil
+}
+
+func (n *fakeNode) validators(ctx *rpctypes.Context, height *int64, pagePtr, perPagePtr *int) (*ctypes.ResultValidators, error) {
+	lb, err := n.lightBlock(height)
+	if err != nil {
+		return nil, err
+	}
+	page, perPage := 1, 30
+	if pagePtr != nil {
+		page = *pagePtr
+	}
+	if perPagePtr != nil {
+		perPage = *perPagePtr
+	}
+	vals := lb.ValidatorSet.Validators
+	start := (page - 1) * perPage
+	if start >= len(vals) {
+		return nil, fmt.Errorf("page %d out of range", page)
+	}
+	end := start + perPage
+	if end > len(vals) {
+		end = len(vals)
+	}
+	return &ctypes.ResultValidators{
+		BlockHeight: lb.Height,
+		Validators:  vals[start:end],
+		Count:       end - start,
+		Total:       len(vals),
+	}, nil
+}
+
+func (n *fakeNode) genesisDoc(ctx *rpctypes.Context) (*ctypes.ResultGenesis, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	doc, err := types.GenesisDocFromJSON(n.genesis)
+	if err != nil {
+		return nil, err
+	}
+	return &ctypes.ResultGenesis{Genesis: doc}, nil
+}
+
+func (n *fakeNode) genesisChunked(ctx *rpctypes.Context, chunk uint) (*genesisChunk, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.chunkSize == 0 {
+		return nil, fmt.Errorf("method not found")
+	}
+	total := (len(n.genesis) + n.chunkSize - 1) / n.chunkSize
+	if int(chunk) >= total {
+		return nil, fmt.Errorf("there are %d chunks, %d is invalid", total, chunk)
+	}
+	end := (int(chunk) + 1) * n.chunkSize
+	if end > len(n.genesis) {
+		end = len(n.genesis)
+	}
+	return &genesisChunk{
+		ChunkNumber: int(chunk),
+		TotalChunks: total,
+		Data:        base64.StdEncoding.EncodeToString(n.genesis[int(chunk)*n.chunkSize : end]),
+	}, nil
+}
@@ -0,0 +1,465 @@
+package node
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackzampolin/cosmos-registrar/pkg/utils"
+	tmjson "github.com/tendermint/tendermint/libs/json"
+	"github.com/tendermint/tendermint/libs/log"
+	rpchttp "github.com/tendermint/tendermint/rpc/client/http"
+	libclient "github.com/tendermint/tendermint/rpc/jsonrpc/client"
+	"github.com/tendermint/tendermint/types"
+)
+
+// genesisReader reads the decompressed genesis stored in the registry
+type genesisReader struct {
+	*gzip.Reader
+	f *os.File
+}
+
+func (g *genesisReader) Close() error {
+	g.Reader.Close()
+	return g.f.Close()
+}
+
+// OpenGenesis opens the genesis registered for a chain for reading. A genesis
+// stored in parts is reassembled and verified against the manifest while it
+// is read; a genesis that fits in a single part, as well as the ones of the
+// chains registered before the genesis was split, is read from
+// genesis.json.gz.
+func OpenGenesis(basePath, chainID string) (r io.ReadCloser, err error) {
+	repoRoot := repoDir{basePath, chainID}
+	if utils.PathExists(repoRoot.manifestPath()) {
+		m, err := LoadGenesisManifest(basePath, chainID)
+		if err != nil {
+			return nil, fmt.Errorf("reading genesis manifest: %s", err)
+		}
+		return openGenesisParts(basePath, chainID, m)
+	}
+	f, err := os.Open(repoRoot.genesisGzPath())
+	if err != nil {
+		return
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("reading %s: %s", repoRoot.genesisGzPath(), err)
+	}
+	return &genesisReader{zr, f}, nil
+}
+
+// genesisChunk is the result of /genesis_chunked
+type genesisChunk struct {
+	ChunkNumber int    `json:"chunk"`
+	TotalChunks int    `json:"total"`
+	Data        string `json:"data"`
+}
+
+// DownloadGenesis downloads the genesis of a chain from a node to a
+// temporary file, removed when the returned reader is closed. If the node
+// supports /genesis_chunked the genesis is streamed chunk by chunk, so that
+// genesis files too large for a single response can be fetched, otherwise it
+// is requested from /genesis.
+func DownloadGenesis(ctx context.Context, rpcAddress string, logger log.Logger) (r io.ReadCloser, err error) {
+	f, err := os.CreateTemp("", "genesis-*.json")
+	if err != nil {
+		return
+	}
+	tmp := &tempFile{f}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+		}
+	}()
+	supported, err := downloadGenesisChunks(ctx, rpcAddress, f, logger)
+	switch {
+	case supported && err != nil:
+		return nil, fmt.Errorf("chunked genesis download: %s", err)
+	case !supported:
+		logger.Debug("node does not support /genesis_chunked, falling back to /genesis", "rpc-addr", rpcAddress, "error", err)
+		if err = fetchGenesis(ctx, rpcAddress, f); err != nil {
+			return
+		}
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+	return tmp, nil
+}
+
+// fetchGenesis writes the genesis served by /genesis to w
+func fetchGenesis(ctx context.Context, rpcAddress string, w io.Writer) error {
+	client, err := Client(rpcAddress)
+	if err != nil {
+		return fmt.Errorf("error creating tendermint client: %s", err)
+	}
+	gen, err := client.Genesis(ctx)
+	if err != nil {
+		return err
+	}
+	raw, err := tmjson.Marshal(gen.Genesis)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(raw)
+	return err
+}
+
+// tempFile is a temporary file removed when closed
+type tempFile struct {
+	*os.File
+}
+
+func (t *tempFile) Close() error {
+	t.File.Close()
+	return os.Remove(t.Name())
+}
+
+// downloadGenesisChunks writes the genesis chunks served by a node to w.
+// supported is false if the node didn't serve the first chunk.
+func downloadGenesisChunks(ctx context.Context, rpcAddress string, w io.Writer, logger log.Logger) (supported bool, err error) {
+	client, err := libclient.New(rpcAddress)
+	if err != nil {
+		return
+	}
+	written := 0
+	for chunk, total := 0, 1; chunk < total; chunk++ {
+		res := &genesisChunk{}
+		if _, err = client.Call(ctx, "genesis_chunked", map[string]interface{}{"chunk": chunk}, res); err != nil {
+			return chunk > 0, err
+		}
+		supported, total = true, res.TotalChunks
+		if res.ChunkNumber != chunk {
+			return supported, fmt.Errorf("asked chunk %d, got %d", chunk, res.ChunkNumber)
+		}
+		data, err := base64.StdEncoding.DecodeString(res.Data)
+		if err != nil {
+			return supported, fmt.Errorf("decoding chunk %d: %s", chunk, err)
+		}
+		if _, err = w.Write(data); err != nil {
+			return supported, err
+		}
+		written += len(data)
+		logger.Info("downloading genesis", "rpc-addr", rpcAddress, "chunk", chunk+1, "total", total, "bytes", written)
+	}
+	return
+}
+
+// OpenGenesisFile opens a genesis file for reading, either plain or gzip
+// compressed
+func OpenGenesisFile(pth string) (r io.ReadCloser, err error) {
+	f, err := os.Open(pth)
+	if err != nil {
+		return
+	}
+	magic := make([]byte, 2)
+	n, _ := io.ReadFull(f, magic)
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return
+	}
+	if !isGzip(magic[:n]) {
+		return f, nil
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("reading %s: %s", pth, err)
+	}
+	return &genesisReader{zr, f}, nil
+}
+
+// StoreGenesis canonicalizes the genesis read from r and stores it in the
+// registry along with its checksum. The genesis is canonicalized, hashed and
+// compressed in a single pass.
+func StoreGenesis(basePath, chainID string, r io.Reader, logger log.Logger) (doc *types.GenesisDoc, err error) {
+	pr, pw := io.Pipe()
+	var (
+		canonical *types.GenesisDoc
+		done      = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		var cerr error
+		canonical, cerr = CanonicalizeGenesis(r, pw)
+		pw.CloseWithError(cerr)
+	}()
+	m, err := writeGenesisParts(basePath, chainID, pr, DefaultGenesisPartSize, logger)
+	// let the canonicalization end if the parts could not be written, and
+	// wait for it so that r is not read once we return
+	pr.CloseWithError(err)
+	<-done
+	if err != nil {
+		removeGenesisParts(basePath, chainID)
+		return nil, err
+	}
+	if err = writeFile(repoDir{basePath, chainID}.genesisSumPath(), []byte(m.SHA256), logger); err != nil {
+		return nil, err
+	}
+	return canonical, nil
+}
+
+// CheckGenesis checks that storing the genesis read from r produces the
+// genesis registered for the chain: the same canonical genesis and, for
+// chains stored in parts, the same compressed parts.
+func CheckGenesis(basePath, chainID string, r io.Reader, logger log.Logger) (err error) {
+	tmp, err := os.MkdirTemp("", "registry-*")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(tmp)
+	if err = os.Mkdir(repoDir{tmp, chainID}.chainPath(), 0755); err != nil {
+		return
+	}
+	if _, err = StoreGenesis(tmp, chainID, r, logger); err != nil {
+		return
+	}
+
+	repoRoot, stored := repoDir{basePath, chainID}, repoDir{tmp, chainID}
+	if err = compareSums(repoRoot.genesisSumPath(), stored.genesisSumPath()); err != nil {
+		return
+	}
+	// chains registered before the checksum of the compressed genesis was
+	// recorded only have the checksum of the genesis
+	if utils.PathExists(repoRoot.genesisGzSumPath()) {
+		if err = compareSums(repoRoot.genesisGzSumPath(), stored.genesisGzSumPath()); err != nil {
+			return
+		}
+	}
+	logger.Debug("genesis matches the registered one", "chainID", chainID)
+	return nil
+}
+
+// compareSums compares a registered checksum file with the one of a newly
+// stored genesis
+func compareSums(registered, actual string) error {
+	r, err := os.ReadFile(registered)
+	if err != nil {
+		return err
+	}
+	a, err := os.ReadFile(actual)
+	if err != nil {
+		return err
+	}
+	if rs, as := strings.TrimSpace(string(r)), strings.TrimSpace(string(a)); rs != as {
+		return fmt.Errorf("the registered %s is %s, the genesis gives %s", path.Base(registered), rs, as)
+	}
+	return nil
+}
+
+// VerifyGenesisOnChain checks that a genesis is the one of the chain a node
+// is on: the chain ID and the initial height must match the ones of the node
+// and the validator set of the genesis must be the one that signed the
+// header at the initial height. A genesis built from gentxs has no
+// validators, they are only known once the chain starts, its app hash is
+// compared with the one of the header instead. The node must still have the
+// block at the initial height.
+func VerifyGenesisOnChain(ctx context.Context, client *rpchttp.HTTP, gen *types.GenesisDoc, logger log.Logger) (err error) {
+	stat, err := client.Status(ctx)
+	if err != nil {
+		return fmt.Errorf("error fetching client status: %s", err)
+	}
+	if gen.ChainID != stat.NodeInfo.Network {
+		return fmt.Errorf("the genesis is for chain %s, the node is on chain %s", gen.ChainID, stat.NodeInfo.Network)
+	}
+	h := gen.InitialHeight
+	switch earliest := stat.SyncInfo.EarliestBlockHeight; {
+	case earliest < h:
+		return fmt.Errorf("the genesis initial height is %d, the node has blocks from height %d", h, earliest)
+	case earliest > h:
+		return fmt.Errorf("the node has pruned the block at the genesis initial height %d (earliest height %d), use an archive node", h, earliest)
+	}
+	commit, err := client.Commit(ctx, &h)
+	if err != nil {
+		return fmt.Errorf("fetching the header at height %d: %s", h, err)
+	}
+	if commit.Header.ChainID != gen.ChainID || commit.Header.Height != h {
+		return fmt.Errorf("the node returned the header of %s at height %d, expected %s at height %d", commit.Header.ChainID, commit.Header.Height, gen.ChainID, h)
+	}
+	if len(gen.Validators) == 0 {
+		if !bytes.Equal(gen.AppHash, commit.Header.AppHash) {
+			return fmt.Errorf("the genesis app hash is %X, the header at height %d has %X", gen.AppHash, h, commit.Header.AppHash)
+		}
+		logger.Debug("genesis without validators verified", "chainID", gen.ChainID, "initial-height", h, "app-hash", commit.Header.AppHash)
+		return
+	}
+	vals := make([]*types.Validator, len(gen.Validators))
+	for i, v := range gen.Validators {
+		vals[i] = types.NewValidator(v.PubKey, v.Power)
+	}
+	hash := types.NewValidatorSet(vals).Hash()
+	if !bytes.Equal(hash, commit.Header.ValidatorsHash) {
+		return fmt.Errorf("the genesis validators hash is %X, the header at height %d has %X", hash, h, commit.Header.ValidatorsHash)
+	}
+	logger.Debug("genesis verified", "chainID", gen.ChainID, "initial-height", h, "validators-hash", commit.Header.ValidatorsHash)
+	return
+}
+
+// GenesisUnbondingTime reads the unbonding time of the staking module from
+// a genesis document. Both the duration format of recent versions ("1814400s")
+// and the nanoseconds of the amino encoded genesis files are accepted.
+func GenesisUnbondingTime(r io.Reader) (d time.Duration, err error) {
+	raw, err := lookupJSON(r, "app_state", "staking", "params", "unbonding_time")
+	if err != nil {
+		return 0, fmt.Errorf("genesis unbonding time: %s", err)
+	}
+	var s string
+	if err = json.Unmarshal(raw, &s); err != nil {
+		return 0, fmt.Errorf("genesis unbonding time: %s", err)
+	}
+	if d, err = parseUnbondingTime(s); err != nil {
+		return 0, fmt.Errorf("genesis unbonding time: %s", err)
+	}
+	return
+}
+
+// parseUnbondingTime parses an unbonding time either as a duration or as
+// nanoseconds
+func parseUnbondingTime(s string) (time.Duration, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, nil
+	}
+	ns, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return time.Duration(ns), nil
+}
+
+// lookupJSON returns the value at the path of object keys in a JSON
+// document. The document is streamed, so that large genesis files are not
+// loaded in memory.
+func lookupJSON(r io.Reader, keys ...string) (raw json.RawMessage, err error) {
+	dec := json.NewDecoder(r)
+	for depth, key := range keys {
+		if err = expectDelim(dec, '{'); err != nil {
+			return nil, fmt.Errorf("%s: %s", strings.Join(keys[:depth], "."), err)
+		}
+		found := false
+		for dec.More() {
+			t, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			if t == key {
+				found = true
+				break
+			}
+			if err = skipJSON(dec); err != nil {
+				return nil, err
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%s not found", strings.Join(keys[:depth+1], "."))
+		}
+	}
+	err = dec.Decode(&raw)
+	return
+}
+
+func expectDelim(dec *json.Decoder, d json.Delim) error {
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if t != d {
+		return fmt.Errorf("expected %s, found %v", d, t)
+	}
+	return nil
+}
+
+// skipJSON skips the next value of the decoder without decoding it
+func skipJSON(dec *json.Decoder) error {
+	depth := 0
+	for {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch t {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// SectionDiff describes a top-level section that differs between a local
+// genesis and the registered one. Short values are reported as they are,
+// longer ones by size and checksum.
+type SectionDiff struct {
+	Key        string
+	Local      string
+	Registered string
+}
+
+// GenesisVerification is the result of the verification of a local genesis
+// against the one registered for a chain
+type GenesisVerification struct {
+	Sum      string
+	Expected string
+	// Diff lists the top-level sections that differ, only when the
+	// checksums don't match
+	Diff []SectionDiff
+}
+
+// Match tells if the local genesis is the registered one
+func (v GenesisVerification) Match() bool { return v.Sum == v.Expected }
+
+// VerifyGenesis canonicalizes the genesis at pth the same way the registry
+// does when a chain is claimed and compares its checksum with the registered
+// one. When they differ the top-level sections of the two are compared.
+func VerifyGenesis(basePath, chainID, pth string) (v *GenesisVerification, err error) {
+	expected, err := LoadGenesisSum(basePath, chainID)
+	if err != nil {
+		return
+	}
+	f, err := OpenGenesisFile(pth)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	sum, _, err := GenesisSum(f)
+	if err != nil {
+		return nil, fmt.Errorf("canonicalizing %s: %s", pth, err)
+	}
+	v = &GenesisVerification{Sum: sum, Expected: strings.TrimSpace(expected)}
+	if v.Match() {
+		return
+	}
+
+	// compare the canonical forms section by section, both are streamed
+	f, err = OpenGenesisFile(pth)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := CanonicalizeGenesis(f, pw)
+		pw.CloseWithError(err)
+	}()
+	defer pr.Close()
+	g, err := OpenGenesis(basePath, chainID)
+	if err != nil {
+		return nil, fmt.Errorf("opening registered genesis: %s", err)
+	}
+	defer g.Close()
+	v.Diff, err = diffGenesis(pr, g)
+	return
+}
@@ -0,0 +1,246 @@
+package node
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	tmjson "github.com/tendermint/tendermint/libs/json"
+	"github.com/tendermint/tendermint/libs/log"
+	"github.com/tendermint/tendermint/types"
+)
+
+func testGenesisDoc(chainID string, appState string) *types.GenesisDoc {
+	return &types.GenesisDoc{
+		ChainID:     chainID,
+		GenesisTime: time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC),
+		AppState:    json.RawMessage(appState),
+	}
+}
+
+func TestVerifyGenesis(t *testing.T) {
+	registry := t.TempDir()
+	doc := testGenesisDoc("test-1", `{"bank":{"balances":[]},"staking":{"params":{"unbonding_time":"1814400s"}}}`)
+	_, indented, err := sortedGenesis(doc)
+	assert.Nil(t, err)
+	writeRegistryChain(t, registry, "test-1", string(indented), nil, nil)
+
+	writeLocal := func(doc *types.GenesisDoc) string {
+		raw, err := tmjson.Marshal(doc)
+		assert.Nil(t, err)
+		pth := path.Join(t.TempDir(), "genesis.json")
+		assert.Nil(t, os.WriteFile(pth, raw, 0644))
+		return pth
+	}
+
+	// the same genesis, not indented
+	v, err := VerifyGenesis(registry, "test-1", writeLocal(doc))
+	assert.Nil(t, err)
+	assert.True(t, v.Match())
+	assert.Empty(t, v.Diff)
+
+	other := testGenesisDoc("test-2", `{"bank":{"balances":[]},"staking":{"params":{"unbonding_time":"1209600s"}}}`)
+	v, err = VerifyGenesis(registry, "test-1", writeLocal(other))
+	assert.Nil(t, err)
+	assert.False(t, v.Match())
+	if assert.Len(t, v.Diff, 2) {
+		assert.Equal(t, "app_state", v.Diff[0].Key)
+		assert.Contains(t, v.Diff[0].Local, "sha256")
+		assert.Equal(t, SectionDiff{Key: "chain_id", Local: `"test-2"`, Registered: `"test-1"`}, v.Diff[1])
+	}
+
+	// not a genesis
+	pth := path.Join(t.TempDir(), "genesis.json")
+	assert.Nil(t, os.WriteFile(pth, []byte(`{"chain_id":""}`), 0644))
+	_, err = VerifyGenesis(registry, "test-1", pth)
+	assert.NotNil(t, err)
+	// unknown chain
+	_, err = VerifyGenesis(registry, "test-2", writeLocal(doc))
+	assert.NotNil(t, err)
+}
+
+func TestDownloadGenesis(t *testing.T) {
+	doc := testGenesisDoc("test-1", `{"staking":{"params":{"unbonding_time":"1814400s"}}}`)
+	raw, err := tmjson.Marshal(doc)
+	assert.Nil(t, err)
+	_, want, err := sortedGenesis(doc)
+	assert.Nil(t, err)
+
+	for _, chunkSize := range []int{0, 7, len(raw), 1 << 20} {
+		t.Run(fmt.Sprint("chunk size ", chunkSize), func(t *testing.T) {
+			n := newFakeNode(t, "aaaa", "test-1", 1)
+			n.ServeGenesis(raw, chunkSize)
+			r, err := DownloadGenesis(context.Background(), n.Address(), log.NewNopLogger())
+			assert.Nil(t, err)
+			got := &bytes.Buffer{}
+			_, err = CanonicalizeGenesis(r, got)
+			assert.Nil(t, err)
+			assert.Nil(t, r.Close())
+			assert.Equal(t, string(want), got.String())
+		})
+	}
+
+	// a broken download does not fall back to /genesis
+	n := newFakeNode(t, "aaaa", "test-1", 1)
+	n.ServeGenesis(raw[:len(raw)-1], 7)
+	r, err := DownloadGenesis(context.Background(), n.Address(), log.NewNopLogger())
+	assert.Nil(t, err)
+	_, err = CanonicalizeGenesis(r, io.Discard)
+	assert.NotNil(t, err)
+	assert.Nil(t, r.Close())
+}
+
+// fakeGenesis returns the genesis of a fake chain, signed by vs at its
+// initial height
+func fakeGenesis(chainID string, vs fakeValSet) *types.GenesisDoc {
+	doc := testGenesisDoc(chainID, `{}`)
+	doc.InitialHeight = 1
+	for _, v := range vs.vals.Validators {
+		doc.Validators = append(doc.Validators, types.GenesisValidator{
+			Address: v.Address,
+			PubKey:  v.PubKey,
+			Power:   v.VotingPower,
+		})
+	}
+	return doc
+}
+
+func TestOpenGenesisFile(t *testing.T) {
+	doc := testGenesisDoc("test-1", `{"staking":{}}`)
+	raw, err := tmjson.Marshal(doc)
+	assert.Nil(t, err)
+	_, want, err := sortedGenesis(doc)
+	assert.Nil(t, err)
+
+	dir := t.TempDir()
+	plain := path.Join(dir, "genesis.json")
+	assert.Nil(t, os.WriteFile(plain, raw, 0644))
+	compressed := path.Join(dir, "genesis.json.gz")
+	f, err := os.Create(compressed)
+	assert.Nil(t, err)
+	zw := gzip.NewWriter(f)
+	_, err = zw.Write(raw)
+	assert.Nil(t, err)
+	assert.Nil(t, zw.Close())
+	assert.Nil(t, f.Close())
+
+	for _, pth := range []string{plain, compressed} {
+		r, err := OpenGenesisFile(pth)
+		assert.Nil(t, err)
+		got := &bytes.Buffer{}
+		_, err = CanonicalizeGenesis(r, got)
+		assert.Nil(t, err)
+		assert.Nil(t, r.Close())
+		assert.Equal(t, string(want), got.String())
+	}
+	_, err = OpenGenesisFile(path.Join(dir, "missing.json"))
+	assert.NotNil(t, err)
+}
+
+func TestVerifyGenesisOnChain(t *testing.T) {
+	vals := newFakeValSet(4)
+	c := newFakeChain(t, "test-1", 5, func(h int64) fakeValSet { return vals })
+	n := newFakeNode(t, "aaaa", "test-1", 0)
+	n.Serve(c)
+	client, err := Client(n.Address())
+	assert.Nil(t, err)
+
+	good := fakeGenesis("test-1", vals)
+	otherChain := fakeGenesis("test-2", vals)
+	otherVals := fakeGenesis("test-1", newFakeValSet(4))
+	later := fakeGenesis("test-1", vals)
+	later.InitialHeight = 3
+	// a genesis built from gentxs has no validators
+	gentxs := fakeGenesis("test-1", vals)
+	gentxs.Validators, gentxs.AppHash = nil, c.blocks[1].AppHash
+	otherAppHash := fakeGenesis("test-1", vals)
+	otherAppHash.Validators = nil
+
+	tests := []struct {
+		name     string
+		doc      *types.GenesisDoc
+		earliest int64
+		wantErr  bool
+	}{
+		{"verified", good, 1, false},
+		{"other chain", otherChain, 1, true},
+		{"other validators", otherVals, 1, true},
+		{"initial height after the earliest block", later, 1, true},
+		{"pruned node", good, 2, true},
+		{"no genesis validators", gentxs, 1, false},
+		{"no genesis validators and other app hash", otherAppHash, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n.mu.Lock()
+			n.earliest = tt.earliest
+			n.mu.Unlock()
+			err := VerifyGenesisOnChain(context.Background(), client, tt.doc, log.NewNopLogger())
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestDumpInfoGenesisFile(t *testing.T) {
+	vals := newFakeValSet(4)
+	c := newFakeChain(t, "test-1", 5, func(h int64) fakeValSet { return vals })
+	n := newFakeNode(t, "aaaa", "test-1", 0)
+	n.Serve(c)
+
+	doc := fakeGenesis("test-1", vals)
+	raw, err := tmjson.Marshal(doc)
+	assert.Nil(t, err)
+	pth := path.Join(t.TempDir(), "genesis.json")
+	assert.Nil(t, os.WriteFile(pth, raw, 0644))
+
+	registry := t.TempDir()
+	assert.Nil(t, DumpInfo(registry, "test-1", n.Address(), pth, nil, log.NewNopLogger()))
+	v, err := VerifyGenesis(registry, "test-1", pth)
+	assert.Nil(t, err)
+	assert.True(t, v.Match())
+
+	b, err := LoadBinaries(registry, "test-1")
+	assert.Nil(t, err)
+	assert.Equal(t, n.version, b.Current)
+
+	// claiming again gives the same genesis files and keeps the known peers
+	repoRoot := repoDir{registry, "test-1"}
+	gzSum, err := os.ReadFile(repoRoot.genesisGzSumPath())
+	assert.Nil(t, err)
+	peers, err := LoadPeerStore(registry, "test-1", DefaultPeerStoreOptions(), log.NewNopLogger())
+	assert.Nil(t, err)
+	peers.Add(&Peer{ID: "other", Reachable: true}, time.Now())
+	assert.Nil(t, peers.Save(registry, "test-1", log.NewNopLogger()))
+	assert.Nil(t, DumpInfo(registry, "test-1", n.Address(), pth, nil, log.NewNopLogger()))
+	again, err := os.ReadFile(repoRoot.genesisGzSumPath())
+	assert.Nil(t, err)
+	assert.Equal(t, gzSum, again)
+	peers, err = LoadPeerStore(registry, "test-1", DefaultPeerStoreOptions(), log.NewNopLogger())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, peers.Len())
+	seed, _ := peers.Get(n.id)
+	assert.Equal(t, 2, seed.Contacts)
+	// and fails if they differ
+	assert.Nil(t, os.WriteFile(repoRoot.genesisGzSumPath(), []byte("00"), 0644))
+	assert.NotNil(t, DumpInfo(registry, "test-1", n.Address(), pth, nil, log.NewNopLogger()))
+
+	// a genesis of another chain is refused
+	other, err := tmjson.Marshal(fakeGenesis("test-1", newFakeValSet(4)))
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(pth, other, 0644))
+	assert.NotNil(t, DumpInfo(t.TempDir(), "test-1", n.Address(), pth, nil, log.NewNopLogger()))
+	// chain IDs that are not safe as a folder are refused
+	assert.NotNil(t, DumpInfo(t.TempDir(), "../test-1", n.Address(), pth, nil, log.NewNopLogger()))
+}
@@ -0,0 +1,327 @@
+package node
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+
+	"github.com/jackzampolin/cosmos-registrar/pkg/utils"
+	"github.com/tendermint/tendermint/libs/log"
+)
+
+// DefaultGenesisPartSize is the maximum size of a genesis part, below the
+// size at which github starts warning about large files
+const DefaultGenesisPartSize = 45 * 1024 * 1024
+
+// genesisGzipLevel is the compression level of the genesis parts. It is
+// pinned, together with the gzip header, so that storing the same genesis
+// again produces the same parts.
+const genesisGzipLevel = 6
+
+// GenesisManifest describes how the genesis of a chain too large for a
+// single file is stored in the registry: the genesis is split in numbered
+// parts, each one a gzip stream, that once concatenated form a single
+// multistream gzip file.
+type GenesisManifest struct {
+	// SHA256 and Size are the checksum and the size of the decompressed
+	// genesis
+	SHA256 string        `json:"sha256"`
+	Size   int64         `json:"size"`
+	Parts  []GenesisPart `json:"parts"`
+}
+
+// GenesisPart is a part of the genesis
+type GenesisPart struct {
+	File   string `json:"file"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// LoadGenesisManifest loads the manifest of the genesis of a chain
+func LoadGenesisManifest(basePath, chainID string) (m *GenesisManifest, err error) {
+	m = &GenesisManifest{}
+	err = utils.FromJSON(repoDir{basePath, chainID}.manifestPath(), m)
+	return
+}
+
+// genesisPartName is the file name of the i-th part of the genesis
+func genesisPartName(i int) string {
+	return fmt.Sprintf("genesis.json.gz.%03d", i)
+}
+
+// writeGenesisParts compresses the genesis read from r into parts of at most
+// about partSize bytes in the chain folder and writes their manifest, along
+// with the checksum of the whole compressed genesis. A genesis that fits in a
+// single part is stored as genesis.json.gz, without manifest. The files of a
+// previous genesis are removed.
+func writeGenesisParts(basePath, chainID string, r io.Reader, partSize int64, logger log.Logger) (m *GenesisManifest, err error) {
+	repoRoot := repoDir{basePath, chainID}
+	if err = removeGenesisParts(basePath, chainID); err != nil {
+		return
+	}
+	pw := &partWriter{dir: repoRoot.chainPath(), partSize: partSize, logger: logger, compressed: sha256.New()}
+	whole := sha256.New()
+	size, err := io.CopyBuffer(io.MultiWriter(pw, whole), r, make([]byte, 1024*1024))
+	if cerr := pw.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		// don't leave truncated parts behind
+		for _, p := range pw.parts {
+			os.Remove(path.Join(repoRoot.chainPath(), p.File))
+		}
+		return nil, fmt.Errorf("writing genesis parts: %s", err)
+	}
+	m = &GenesisManifest{
+		SHA256: hex.EncodeToString(whole.Sum(nil)),
+		Size:   size,
+		Parts:  pw.parts,
+	}
+	if len(m.Parts) == 1 {
+		single := path.Join(repoRoot.chainPath(), m.Parts[0].File)
+		if err = os.Rename(single, repoRoot.genesisGzPath()); err != nil {
+			os.Remove(single)
+			return nil, fmt.Errorf("writing genesis: %s", err)
+		}
+		m.Parts[0].File = path.Base(repoRoot.genesisGzPath())
+	} else if err = utils.ToJSON(repoRoot.manifestPath(), m); err != nil {
+		return nil, fmt.Errorf("writing genesis manifest: %s", err)
+	}
+	if err = writeFile(repoRoot.genesisGzSumPath(), []byte(hex.EncodeToString(pw.compressed.Sum(nil))), logger); err != nil {
+		return nil, err
+	}
+	logger.Debug("genesis written", "parts", len(m.Parts), "size", m.Size)
+	return
+}
+
+// removeGenesisParts removes the stored genesis of a chain, either its parts
+// and manifest or the single genesis.json.gz
+func removeGenesisParts(basePath, chainID string) error {
+	repoRoot := repoDir{basePath, chainID}
+	files := []string{}
+	if m, err := LoadGenesisManifest(basePath, chainID); err == nil {
+		for _, p := range m.Parts {
+			files = append(files, path.Join(repoRoot.chainPath(), path.Base(p.File)))
+		}
+	}
+	// the manifest goes last, so that a failed removal can be retried
+	files = append(files, repoRoot.genesisGzPath(), repoRoot.genesisGzSumPath(), repoRoot.manifestPath())
+	for _, f := range files {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// partWriter compresses what is written to it in a sequence of gzip files,
+// starting a new one when the current one reaches partSize
+type partWriter struct {
+	dir      string
+	partSize int64
+	logger   log.Logger
+	// compressed hashes the parts as a single file
+	compressed hash.Hash
+
+	parts []GenesisPart
+	f     *os.File
+	zw    *gzip.Writer
+	cw    *countingWriter
+}
+
+func (pw *partWriter) Write(b []byte) (n int, err error) {
+	for len(b) > 0 {
+		if pw.f == nil {
+			if err = pw.open(); err != nil {
+				return
+			}
+		}
+		// the compressed size is only known after writing, write in small
+		// slices so that the parts don't grow much beyond partSize
+		chunk := b
+		if len(chunk) > 64*1024 {
+			chunk = chunk[:64*1024]
+		}
+		written, err := pw.zw.Write(chunk)
+		n += written
+		if err != nil {
+			return n, err
+		}
+		b = b[written:]
+		if pw.cw.n >= pw.partSize {
+			if err = pw.closePart(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return
+}
+
+func (pw *partWriter) open() (err error) {
+	name := genesisPartName(len(pw.parts))
+	if pw.f, err = os.Create(path.Join(pw.dir, name)); err != nil {
+		return
+	}
+	pw.cw = &countingWriter{w: io.MultiWriter(pw.f, pw.compressed), h: sha256.New()}
+	if pw.zw, err = gzip.NewWriterLevel(pw.cw, genesisGzipLevel); err != nil {
+		pw.f.Close()
+		return
+	}
+	// no file name nor modification time, the parts only depend on the
+	// genesis
+	pw.zw.Header = gzip.Header{OS: 255}
+	pw.parts = append(pw.parts, GenesisPart{File: name})
+	pw.logger.Debug("writing genesis part", "file", name)
+	return
+}
+
+// closePart completes the current part and records its checksum
+func (pw *partWriter) closePart() (err error) {
+	if err = pw.zw.Close(); err != nil {
+		pw.f.Close()
+		return
+	}
+	if err = pw.f.Close(); err != nil {
+		return
+	}
+	p := &pw.parts[len(pw.parts)-1]
+	p.SHA256, p.Size = hex.EncodeToString(pw.cw.h.Sum(nil)), pw.cw.n
+	pw.f, pw.zw, pw.cw = nil, nil, nil
+	return
+}
+
+// Close completes the last part, an empty genesis is stored as a single
+// empty gzip stream
+func (pw *partWriter) Close() error {
+	if pw.f == nil && len(pw.parts) == 0 {
+		if err := pw.open(); err != nil {
+			return err
+		}
+	}
+	if pw.f == nil {
+		return nil
+	}
+	return pw.closePart()
+}
+
+// countingWriter counts and hashes what is written through it
+type countingWriter struct {
+	w io.Writer
+	h hash.Hash
+	n int64
+}
+
+func (cw *countingWriter) Write(b []byte) (n int, err error) {
+	n, err = cw.w.Write(b)
+	cw.h.Write(b[:n])
+	cw.n += int64(n)
+	return
+}
+
+// partsReader reads the parts of the genesis in order, verifying the
+// checksum of each one at its end
+type partsReader struct {
+	dir   string
+	parts []GenesisPart
+
+	f *os.File
+	h hash.Hash
+	n int64
+}
+
+func (pr *partsReader) Read(b []byte) (n int, err error) {
+	for {
+		if pr.f == nil {
+			if len(pr.parts) == 0 {
+				return 0, io.EOF
+			}
+			if pr.f, err = os.Open(path.Join(pr.dir, path.Base(pr.parts[0].File))); err != nil {
+				return 0, err
+			}
+			pr.h, pr.n = sha256.New(), 0
+		}
+		n, err = pr.f.Read(b)
+		pr.h.Write(b[:n])
+		pr.n += int64(n)
+		if err != io.EOF {
+			return
+		}
+		// end of the part
+		p := pr.parts[0]
+		pr.f.Close()
+		pr.f, pr.parts = nil, pr.parts[1:]
+		if sum := hex.EncodeToString(pr.h.Sum(nil)); sum != p.SHA256 || pr.n != p.Size {
+			return n, fmt.Errorf("genesis part %s has sha256 %s and size %d, expected %s and %d", p.File, sum, pr.n, p.SHA256, p.Size)
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+func (pr *partsReader) Close() error {
+	if pr.f != nil {
+		return pr.f.Close()
+	}
+	return nil
+}
+
+// verifyingReader checks the checksum and the size of what is read at
+// the end of the stream
+type verifyingReader struct {
+	r      io.Reader
+	h      hash.Hash
+	n      int64
+	sha256 string
+	size   int64
+}
+
+func (vr *verifyingReader) Read(b []byte) (n int, err error) {
+	n, err = vr.r.Read(b)
+	vr.h.Write(b[:n])
+	vr.n += int64(n)
+	if err == io.EOF {
+		if sum := hex.EncodeToString(vr.h.Sum(nil)); sum != vr.sha256 || vr.n != vr.size {
+			return n, fmt.Errorf("genesis has sha256 %s and size %d, expected %s and %d", sum, vr.n, vr.sha256, vr.size)
+		}
+	}
+	return
+}
+
+// openGenesisParts opens the genesis stored in parts, the content is
+// verified against the manifest while it is read
+func openGenesisParts(basePath, chainID string, m *GenesisManifest) (io.ReadCloser, error) {
+	pr := &partsReader{dir: repoDir{basePath, chainID}.chainPath(), parts: m.Parts}
+	zr, err := gzip.NewReader(pr)
+	if err != nil {
+		pr.Close()
+		return nil, fmt.Errorf("reading genesis parts: %s", err)
+	}
+	return &partsGenesisReader{
+		Reader: &verifyingReader{r: zr, h: sha256.New(), sha256: m.SHA256, size: m.Size},
+		zr:     zr,
+		pr:     pr,
+	}, nil
+}
+
+type partsGenesisReader struct {
+	io.Reader
+	zr *gzip.Reader
+	pr *partsReader
+}
+
+func (g *partsGenesisReader) Close() error {
+	g.zr.Close()
+	return g.pr.Close()
+}
+
+// isGzip tells if b starts like a gzip stream
+func isGzip(b []byte) bool {
+	return bytes.HasPrefix(b, []byte{0x1f, 0x8b})
+}
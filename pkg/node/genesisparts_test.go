@@ -0,0 +1,199 @@
+package node
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"math/rand"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/jackzampolin/cosmos-registrar/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/tendermint/tendermint/libs/log"
+)
+
+func readGenesis(t *testing.T, dir, chainID string) ([]byte, error) {
+	g, err := OpenGenesis(dir, chainID)
+	if err != nil {
+		return nil, err
+	}
+	defer g.Close()
+	return io.ReadAll(g)
+}
+
+func TestGenesisParts(t *testing.T) {
+	// random data does not compress, so it spans several parts
+	genesis := make([]byte, 1024*1024)
+	rand.New(rand.NewSource(1)).Read(genesis)
+
+	tests := []struct {
+		name     string
+		genesis  []byte
+		partSize int64
+		parts    int
+	}{
+		{"single part", genesis, DefaultGenesisPartSize, 1},
+		{"several parts", genesis, 300 * 1024, 4},
+		{"empty", []byte{}, 1024, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			assert.Nil(t, os.MkdirAll(repoDir{dir, "test-1"}.chainPath(), 0700))
+			m, err := writeGenesisParts(dir, "test-1", bytes.NewReader(tt.genesis), tt.partSize, log.NewNopLogger())
+			assert.Nil(t, err)
+			assert.Len(t, m.Parts, tt.parts)
+			assert.Equal(t, int64(len(tt.genesis)), m.Size)
+			for _, p := range m.Parts {
+				// parts may exceed the size by the last write
+				assert.True(t, p.Size < tt.partSize+128*1024, "part %s is %d bytes", p.File, p.Size)
+			}
+			got, err := readGenesis(t, dir, "test-1")
+			assert.Nil(t, err)
+			assert.Equal(t, tt.genesis, got)
+
+			// a single part is stored as genesis.json.gz, without manifest
+			repoRoot := repoDir{dir, "test-1"}
+			if tt.parts == 1 {
+				assert.True(t, fileExists(repoRoot.genesisGzPath()))
+				assert.False(t, fileExists(repoRoot.manifestPath()))
+				assert.False(t, fileExists(path.Join(repoRoot.chainPath(), genesisPartName(0))))
+				return
+			}
+			assert.False(t, fileExists(repoRoot.genesisGzPath()))
+			loaded, err := LoadGenesisManifest(dir, "test-1")
+			assert.Nil(t, err)
+			assert.Equal(t, m, loaded)
+		})
+	}
+}
+
+func TestGenesisPartsRewrite(t *testing.T) {
+	dir := t.TempDir()
+	chainPath := repoDir{dir, "test-1"}.chainPath()
+	assert.Nil(t, os.MkdirAll(chainPath, 0700))
+	genesis := make([]byte, 1024*1024)
+	rand.New(rand.NewSource(1)).Read(genesis)
+	repoRoot := repoDir{dir, "test-1"}
+	_, err := writeGenesisParts(dir, "test-1", bytes.NewReader(genesis), 300*1024, log.NewNopLogger())
+	assert.Nil(t, err)
+	// the parts of the previous genesis are removed
+	_, err = writeGenesisParts(dir, "test-1", bytes.NewReader([]byte(`{}`)), 300*1024, log.NewNopLogger())
+	assert.Nil(t, err)
+	assert.False(t, fileExists(path.Join(chainPath, genesisPartName(0))))
+	assert.False(t, fileExists(path.Join(chainPath, genesisPartName(1))))
+	assert.False(t, fileExists(repoRoot.manifestPath()))
+	assert.True(t, fileExists(repoRoot.genesisGzPath()))
+	assert.True(t, fileExists(repoRoot.genesisGzSumPath()))
+	got, err := readGenesis(t, dir, "test-1")
+	assert.Nil(t, err)
+	assert.Equal(t, `{}`, string(got))
+
+	// and so is the single file
+	_, err = writeGenesisParts(dir, "test-1", bytes.NewReader(genesis), 300*1024, log.NewNopLogger())
+	assert.Nil(t, err)
+	assert.False(t, fileExists(repoRoot.genesisGzPath()))
+	assert.True(t, fileExists(path.Join(chainPath, genesisPartName(1))))
+	got, err = readGenesis(t, dir, "test-1")
+	assert.Nil(t, err)
+	assert.Equal(t, genesis, got)
+}
+
+func TestGenesisPartsDeterministic(t *testing.T) {
+	genesis := make([]byte, 1024*1024)
+	rand.New(rand.NewSource(1)).Read(genesis)
+	write := func() (parts [][]byte, gzSum string) {
+		dir := t.TempDir()
+		repoRoot := repoDir{dir, "test-1"}
+		assert.Nil(t, os.MkdirAll(repoRoot.chainPath(), 0700))
+		m, err := writeGenesisParts(dir, "test-1", bytes.NewReader(genesis), 300*1024, log.NewNopLogger())
+		assert.Nil(t, err)
+		whole := sha256.New()
+		for _, p := range m.Parts {
+			b, err := os.ReadFile(path.Join(repoRoot.chainPath(), p.File))
+			assert.Nil(t, err)
+			parts = append(parts, b)
+			whole.Write(b)
+		}
+		sum, err := os.ReadFile(repoRoot.genesisGzSumPath())
+		assert.Nil(t, err)
+		assert.Equal(t, hex.EncodeToString(whole.Sum(nil)), string(sum))
+		return parts, string(sum)
+	}
+
+	parts, sum := write()
+	assert.Greater(t, len(parts), 1)
+	for _, p := range parts {
+		// no modification time nor file name in the header
+		assert.Equal(t, []byte{0, 0, 0, 0}, p[4:8])
+		assert.Zero(t, p[3]&0x08)
+	}
+	again, againSum := write()
+	assert.Equal(t, parts, again)
+	assert.Equal(t, sum, againSum)
+}
+
+func TestGenesisPartsCorruption(t *testing.T) {
+	genesis := make([]byte, 1024*1024)
+	rand.New(rand.NewSource(1)).Read(genesis)
+	setup := func(t *testing.T) (string, *GenesisManifest) {
+		dir := t.TempDir()
+		assert.Nil(t, os.MkdirAll(repoDir{dir, "test-1"}.chainPath(), 0700))
+		m, err := writeGenesisParts(dir, "test-1", bytes.NewReader(genesis), 300*1024, log.NewNopLogger())
+		assert.Nil(t, err)
+		return dir, m
+	}
+	partPath := func(dir string, i int) string {
+		return path.Join(repoDir{dir, "test-1"}.chainPath(), genesisPartName(i))
+	}
+
+	t.Run("corrupted part", func(t *testing.T) {
+		dir, _ := setup(t)
+		raw, err := os.ReadFile(partPath(dir, 1))
+		assert.Nil(t, err)
+		raw[100] ^= 0xff
+		assert.Nil(t, os.WriteFile(partPath(dir, 1), raw, 0644))
+		_, err = readGenesis(t, dir, "test-1")
+		assert.NotNil(t, err)
+	})
+	t.Run("missing part", func(t *testing.T) {
+		dir, _ := setup(t)
+		assert.Nil(t, os.Remove(partPath(dir, 2)))
+		_, err := readGenesis(t, dir, "test-1")
+		assert.NotNil(t, err)
+	})
+	t.Run("wrong checksum", func(t *testing.T) {
+		dir, m := setup(t)
+		m.SHA256 = "00"
+		assert.Nil(t, utils.ToJSON(repoDir{dir, "test-1"}.manifestPath(), m))
+		_, err := readGenesis(t, dir, "test-1")
+		assert.NotNil(t, err)
+	})
+	t.Run("parts out of order", func(t *testing.T) {
+		dir, m := setup(t)
+		m.Parts[0], m.Parts[1] = m.Parts[1], m.Parts[0]
+		assert.Nil(t, utils.ToJSON(repoDir{dir, "test-1"}.manifestPath(), m))
+		_, err := readGenesis(t, dir, "test-1")
+		assert.NotNil(t, err)
+	})
+}
+
+func TestOpenGenesisLegacy(t *testing.T) {
+	dir := t.TempDir()
+	repoRoot := repoDir{dir, "test-1"}
+	assert.Nil(t, os.MkdirAll(repoRoot.chainPath(), 0700))
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte(`{"chain_id":"test-1"}`))
+	assert.Nil(t, err)
+	assert.Nil(t, zw.Close())
+	assert.Nil(t, os.WriteFile(repoRoot.genesisGzPath(), buf.Bytes(), 0644))
+
+	got, err := readGenesis(t, dir, "test-1")
+	assert.Nil(t, err)
+	assert.Equal(t, `{"chain_id":"test-1"}`, string(got))
+}
@@ -0,0 +1,70 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/tendermint/tendermint/crypto/ed25519"
+	"github.com/tendermint/tendermint/p2p"
+	"github.com/tendermint/tendermint/p2p/conn"
+)
+
+// The outcomes of the verification of the node ID of a peer
+const (
+	// IdentityVerified is a peer whose p2p key matches its node ID
+	IdentityVerified = "verified"
+	// IdentityImpersonated is a peer whose p2p address answers with the key
+	// of another node
+	IdentityImpersonated = "impersonated"
+)
+
+// VerifyIdentity performs the tendermint p2p handshake with the p2p address
+// of a peer and compares the node ID of the key it authenticates with to the
+// ID of the peer, which is marked as verified or impersonated. A peer the
+// handshake fails with is left as it is and an error is returned.
+func (p *Peer) VerifyIdentity(ctx context.Context) (err error) {
+	if p.P2PAddr == "" {
+		return fmt.Errorf("peer %s has no p2p address", p.ID)
+	}
+	id, err := handshakeID(ctx, p.P2PAddr)
+	if err != nil {
+		return fmt.Errorf("handshake with %s: %s", p.P2PAddr, err)
+	}
+	p.Identity = IdentityVerified
+	if string(id) != p.ID {
+		p.Identity = IdentityImpersonated
+	}
+	return nil
+}
+
+// handshakeID opens a secret connection to a p2p address with a throwaway
+// key and returns the node ID of the remote key
+func handshakeID(ctx context.Context, addr string) (id p2p.ID, err error) {
+	var d net.Dialer
+	c, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return
+	}
+	defer c.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err = c.SetDeadline(deadline); err != nil {
+			return
+		}
+	}
+	// the handshake does not watch the context
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Close()
+		case <-stop:
+		}
+	}()
+	sc, err := conn.MakeSecretConnection(c, ed25519.GenPrivKey())
+	if err != nil {
+		return
+	}
+	return p2p.PubKeyToID(sc.RemotePubKey()), nil
+}
@@ -0,0 +1,62 @@
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tendermint/tendermint/crypto/ed25519"
+	"github.com/tendermint/tendermint/p2p"
+)
+
+func TestVerifyIdentity(t *testing.T) {
+	key, other := ed25519.GenPrivKey(), ed25519.GenPrivKey()
+	id := string(p2p.PubKeyToID(key.PubKey()))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	p := &Peer{ID: id, P2PAddr: listenP2P(t, key).Addr().String()}
+	assert.Nil(t, p.VerifyIdentity(ctx))
+	assert.Equal(t, IdentityVerified, p.Identity)
+
+	p = &Peer{ID: id, P2PAddr: listenP2P(t, other).Addr().String()}
+	assert.Nil(t, p.VerifyIdentity(ctx))
+	assert.Equal(t, IdentityImpersonated, p.Identity)
+
+	// the handshake fails, nothing is known about the identity
+	p = &Peer{ID: id, P2PAddr: listenP2P(t, nil).Addr().String()}
+	assert.NotNil(t, p.VerifyIdentity(ctx))
+	assert.Empty(t, p.Identity)
+	assert.NotNil(t, (&Peer{ID: id}).VerifyIdentity(ctx))
+
+	// nothing listens on the p2p address
+	l := listenP2P(t, nil)
+	l.Close()
+	silent := &Peer{ID: id, P2PAddr: l.Addr().String()}
+	assert.NotNil(t, silent.VerifyIdentity(ctx))
+}
+
+func TestCrawlVerifyIdentity(t *testing.T) {
+	ka, kb := ed25519.GenPrivKey(), ed25519.GenPrivKey()
+	a := newFakeNode(t, string(p2p.PubKeyToID(ka.PubKey())), "test-1", 10)
+	b := newFakeNode(t, "bbbb", "test-1", 10)
+	a.Connect(b)
+	a.ListenP2P(t, ka)
+	// b answers with a key that is not its own
+	b.ListenP2P(t, kb)
+
+	seed := a.Peer()
+	opts := CrawlOptions{MaxDepth: 1, MaxPeers: 100}
+	got := crawlFakes(map[string]*Peer{seed.ID: a.Peer()}, opts)
+	assert.Empty(t, got[seed.ID].Identity)
+	assert.True(t, got["bbbb"].Reachable)
+
+	opts.VerifyIdentity = true
+	got = crawlFakes(map[string]*Peer{seed.ID: a.Peer()}, opts)
+	assert.Equal(t, IdentityVerified, got[seed.ID].Identity)
+	assert.True(t, got[seed.ID].Reachable)
+	assert.Equal(t, IdentityImpersonated, got["bbbb"].Identity)
+	assert.False(t, got["bbbb"].Reachable)
+	assert.False(t, got["bbbb"].p2pUsable())
+}
@@ -1,27 +1,85 @@
 package node
 
 import (
+	"encoding/json"
+	"fmt"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	tmtypes "github.com/tendermint/tendermint/types"
 )
 
 // LightRoot is the format for a light client root file which
-// will be used for state sync
+// will be used for state sync. Entries written by older versions of the
+// registrar only have the trust height and hash.
 type LightRoot struct {
-	TrustHeight int64  `json:"trust-height"`
-	TrustHash   string `json:"trust-hash"`
+	TrustHeight        int64     `json:"trust-height"`
+	TrustHash          string    `json:"trust-hash"`
+	ChainID            string    `json:"chain-id,omitempty"`
+	Time               time.Time `json:"time,omitempty"`
+	AppHash            string    `json:"app-hash,omitempty"`
+	ValidatorsHash     string    `json:"validators-hash,omitempty"`
+	NextValidatorsHash string    `json:"next-validators-hash,omitempty"`
+	// Peers are the IDs of the peers that attested the root
+	Peers []string `json:"peers,omitempty"`
 }
 
 // NewLightRoot returns a new light root
 func NewLightRoot(sh tmtypes.SignedHeader) *LightRoot {
 	return &LightRoot{
-		TrustHeight: sh.Header.Height,
-		TrustHash:   sh.Commit.BlockID.Hash.String(),
+		TrustHeight:        sh.Header.Height,
+		TrustHash:          sh.Commit.BlockID.Hash.String(),
+		ChainID:            sh.Header.ChainID,
+		Time:               sh.Header.Time,
+		AppHash:            sh.Header.AppHash.String(),
+		ValidatorsHash:     sh.Header.ValidatorsHash.String(),
+		NextValidatorsHash: sh.Header.NextValidatorsHash.String(),
 	}
 }
 
+// MarshalJSON implements json.Marshaler, the time is omitted when unknown
+func (lr LightRoot) MarshalJSON() ([]byte, error) {
+	type lightRoot LightRoot
+	out := struct {
+		lightRoot
+		Time *time.Time `json:"time,omitempty"`
+	}{lightRoot: lightRoot(lr)}
+	if !lr.Time.IsZero() {
+		out.Time = &lr.Time
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, it also accepts the trust height
+// as a string, the way it is written in the tendermint config
+func (lr *LightRoot) UnmarshalJSON(b []byte) (err error) {
+	type lightRoot LightRoot
+	in := struct {
+		*lightRoot
+		TrustHeight json.RawMessage `json:"trust-height"`
+	}{lightRoot: (*lightRoot)(lr)}
+	if err = json.Unmarshal(b, &in); err != nil {
+		return
+	}
+	h := strings.Trim(string(in.TrustHeight), `"`)
+	if h == "" || h == "null" {
+		return fmt.Errorf("light root without trust-height")
+	}
+	if lr.TrustHeight, err = strconv.ParseInt(h, 10, 64); err != nil {
+		return fmt.Errorf("invalid trust-height %s: %s", in.TrustHeight, err)
+	}
+	return
+}
+
+// sameBlock tells if two light roots are for the same block
+func (lr LightRoot) sameBlock(other LightRoot) bool {
+	return lr.TrustHeight == other.TrustHeight && strings.EqualFold(lr.TrustHash, other.TrustHash)
+}
+
 type LightRootHistory = []LightRoot
 
 type result struct {
@@ -79,6 +137,115 @@ func (h *LightRootResults) Same() bool {
 	return true
 }
 
+// Agree groups the results by light root and returns the root reported by the
+// largest group of peers, provided the group satisfies the policy, with the
+// agreeing peers recorded as attesting peers. It also returns the IDs of the
+// peers that reported a different root, sorted.
+func (h *LightRootResults) Agree(p AgreementPolicy) (lr *LightRoot, dissenters []string, err error) {
+	h.rw.RLock()
+	defer h.rw.RUnlock()
+
+	total := len(h.lightroots)
+	if total == 0 {
+		return nil, nil, fmt.Errorf("no peer reported a light root")
+	}
+
+	// count the peers reporting each root
+	type group struct {
+		lr    *LightRoot
+		peers []string
+	}
+	groups := map[string]*group{}
+	for peerID, r := range h.lightroots {
+		key := fmt.Sprintf("%d/%s", r.TrustHeight, strings.ToUpper(r.TrustHash))
+		g, ok := groups[key]
+		if !ok {
+			g = &group{lr: r}
+			groups[key] = g
+		}
+		g.peers = append(g.peers, peerID)
+	}
+	var best *group
+	tie := false
+	for _, g := range groups {
+		switch {
+		case best == nil || len(g.peers) > len(best.peers):
+			best, tie = g, false
+		case len(g.peers) == len(best.peers):
+			tie = true
+		}
+	}
+
+	agreeing := len(best.peers)
+	switch {
+	case tie:
+		return nil, nil, fmt.Errorf("no majority among %d peers, the largest groups have %d peers each", total, agreeing)
+	case agreeing < p.MinPeers:
+		return nil, nil, fmt.Errorf("only %d peers agree on %s, at least %d are required", agreeing, best.lr.TrustHash, p.MinPeers)
+	case agreeing*p.Denominator < total*p.Numerator:
+		return nil, nil, fmt.Errorf("only %d/%d peers agree on %s, at least %d/%d are required", agreeing, total, best.lr.TrustHash, p.Numerator, p.Denominator)
+	}
+
+	for peerID, r := range h.lightroots {
+		if !r.sameBlock(*best.lr) {
+			dissenters = append(dissenters, peerID)
+		}
+	}
+	sort.Strings(dissenters)
+	// the agreeing peers attest the root
+	agreed := *best.lr
+	agreed.Peers = append([]string{}, best.peers...)
+	sort.Strings(agreed.Peers)
+	return &agreed, dissenters, nil
+}
+
+// AgreementPolicy is the condition for a light root to be accepted: it must be
+// reported by at least Numerator/Denominator of the responding peers and by
+// no less than MinPeers peers
+type AgreementPolicy struct {
+	Numerator   int
+	Denominator int
+	MinPeers    int
+}
+
+// DefaultAgreementPolicy requires 2/3 of the responding peers and at least 2
+// of them to agree
+func DefaultAgreementPolicy() AgreementPolicy {
+	return AgreementPolicy{
+		Numerator:   2,
+		Denominator: 3,
+		MinPeers:    2,
+	}
+}
+
+// NewAgreementPolicy builds a policy from a fraction in the form "2/3" and a
+// minimum number of peers
+func NewAgreementPolicy(quorum string, minPeers int) (p AgreementPolicy, err error) {
+	parts := strings.Split(strings.TrimSpace(quorum), "/")
+	if len(parts) != 2 {
+		return p, fmt.Errorf("quorum %q is not a fraction like 2/3", quorum)
+	}
+	if p.Numerator, err = strconv.Atoi(strings.TrimSpace(parts[0])); err != nil {
+		return p, fmt.Errorf("quorum %q: invalid numerator: %s", quorum, err)
+	}
+	if p.Denominator, err = strconv.Atoi(strings.TrimSpace(parts[1])); err != nil {
+		return p, fmt.Errorf("quorum %q: invalid denominator: %s", quorum, err)
+	}
+	if p.Numerator <= 0 || p.Denominator <= 0 || p.Numerator > p.Denominator {
+		return p, fmt.Errorf("quorum %q must be a fraction between 0 and 1", quorum)
+	}
+	if minPeers < 1 {
+		return p, fmt.Errorf("the minimum number of agreeing peers must be at least 1")
+	}
+	p.MinPeers = minPeers
+	return p, nil
+}
+
+// String implements fmt.Stringer
+func (p AgreementPolicy) String() string {
+	return fmt.Sprintf("%d/%d of peers, at least %d", p.Numerator, p.Denominator, p.MinPeers)
+}
+
 func NewLightRootResults() *LightRootResults {
 	n := new(LightRootResults)
 	n.lightroots = make(map[string]*LightRoot)
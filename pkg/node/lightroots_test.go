@@ -8,8 +8,59 @@ import (
 
 func TestLightRootResultsSame(t *testing.T) {
 	lrr := NewLightRootResults()
-	lrr.AddResult("cfd785a4224c7940e9a10f6c1ab24c343e923bec", &LightRoot{6765853, "E37F5936731F7F0FF35497255C666B91E719896A2E1E2F55A778A970AF92157E"})
-	lrr.AddResult("a6f325ea73533648fd3176e612915a83e2a2572f", &LightRoot{6765853, "E37F5936731F7F0FF35497255C666B91E719896A2E1E2F55A778A970AF92157E"})
+	lrr.AddResult("cfd785a4224c7940e9a10f6c1ab24c343e923bec", &LightRoot{TrustHeight: 6765853, TrustHash: "E37F5936731F7F0FF35497255C666B91E719896A2E1E2F55A778A970AF92157E"})
+	lrr.AddResult("a6f325ea73533648fd3176e612915a83e2a2572f", &LightRoot{TrustHeight: 6765853, TrustHash: "E37F5936731F7F0FF35497255C666B91E719896A2E1E2F55A778A970AF92157E"})
 
 	assert.True(t, lrr.Same())
 }
+
+func TestLightRootResultsAgree(t *testing.T) {
+	good := &LightRoot{TrustHeight: 6765853, TrustHash: "E37F5936731F7F0FF35497255C666B91E719896A2E1E2F55A778A970AF92157E"}
+	bad := &LightRoot{TrustHeight: 6765853, TrustHash: "0000000000000000000000000000000000000000000000000000000000000000"}
+
+	tests := []struct {
+		name           string
+		results        map[string]*LightRoot
+		policy         AgreementPolicy
+		wantErr        bool
+		wantDissenters []string
+	}{
+		{"unanimous", map[string]*LightRoot{"a": good, "b": good, "c": good}, DefaultAgreementPolicy(), false, nil},
+		{"one dissenter", map[string]*LightRoot{"a": good, "b": good, "c": bad}, DefaultAgreementPolicy(), false, []string{"c"}},
+		{"below quorum", map[string]*LightRoot{"a": good, "b": good, "c": bad, "d": bad, "e": &LightRoot{TrustHeight: 1, TrustHash: "X"}}, DefaultAgreementPolicy(), true, nil},
+		{"tie", map[string]*LightRoot{"a": good, "b": bad}, AgreementPolicy{1, 2, 1}, true, nil},
+		{"below min peers", map[string]*LightRoot{"a": good}, DefaultAgreementPolicy(), true, nil},
+		{"single peer allowed", map[string]*LightRoot{"a": good}, AgreementPolicy{2, 3, 1}, false, nil},
+		{"no results", map[string]*LightRoot{}, DefaultAgreementPolicy(), true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lrr := NewLightRootResults()
+			for id, lr := range tt.results {
+				lrr.AddResult(id, lr)
+			}
+			lr, dissenters, err := lrr.Agree(tt.policy)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.True(t, good.sameBlock(*lr))
+			assert.Equal(t, tt.wantDissenters, dissenters)
+			assert.Len(t, lr.Peers, len(tt.results)-len(tt.wantDissenters))
+		})
+	}
+}
+
+func TestNewAgreementPolicy(t *testing.T) {
+	p, err := NewAgreementPolicy("2/3", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultAgreementPolicy(), p)
+
+	for _, q := range []string{"", "2", "3/2", "a/3", "0/3", "2/0"} {
+		_, err = NewAgreementPolicy(q, 2)
+		assert.NotNil(t, err, q)
+	}
+	_, err = NewAgreementPolicy("1/2", 0)
+	assert.NotNil(t, err)
+}
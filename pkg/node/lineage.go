@@ -0,0 +1,107 @@
+package node
+
+import (
+	"fmt"
+
+	"github.com/jackzampolin/cosmos-registrar/pkg/utils"
+	"github.com/tendermint/tendermint/libs/log"
+)
+
+// Upgrade is an upgrade that halted a chain and continued it as a new chain,
+// exporting the state of the halted one into the new genesis
+type Upgrade struct {
+	Predecessor string `json:"predecessor"`
+	Successor   string `json:"successor"`
+	HaltHeight  int64  `json:"halt-height"`
+	Name        string `json:"upgrade-name,omitempty"`
+}
+
+// Lineage links a chain to the chain it continues and to the chain that
+// continues it
+type Lineage struct {
+	Predecessor *Upgrade `json:"predecessor,omitempty"`
+	Successor   *Upgrade `json:"successor,omitempty"`
+}
+
+// LoadLineage loads the lineage of a chain, a chain without lineage file
+// has no predecessor nor successor
+func LoadLineage(basePath, chainID string) (l *Lineage, err error) {
+	repoRoot := repoDir{basePath, chainID}
+	l = &Lineage{}
+	if !utils.PathExists(repoRoot.lineagePath()) {
+		return
+	}
+	err = utils.FromJSON(repoRoot.lineagePath(), l)
+	return
+}
+
+// Validate checks that the upgrade links two different chains of the
+// registry. When both chain IDs are revisions of the same chain the
+// successor has to be a later revision, and when the successor starts from
+// the height the predecessor halted at its initial height has to follow the
+// halt height.
+func (u Upgrade) Validate(basePath string) error {
+	pred, err := ParseChainID(u.Predecessor)
+	if err != nil {
+		return err
+	}
+	succ, err := ParseChainID(u.Successor)
+	if err != nil {
+		return err
+	}
+	switch {
+	case pred.ID == succ.ID:
+		return fmt.Errorf("a chain cannot succeed itself")
+	case pred.Name == succ.Name && succ.Revision <= pred.Revision:
+		return fmt.Errorf("%s is not a later revision than %s", succ, pred)
+	case u.HaltHeight <= 0:
+		return fmt.Errorf("invalid halt height %d", u.HaltHeight)
+	}
+	for _, c := range []ChainID{pred, succ} {
+		if !utils.PathExists(repoDir{basePath, c.ID}.chainPath()) {
+			return fmt.Errorf("chain %s is not in the registry", c)
+		}
+	}
+	if utils.PathExists(repoDir{basePath, succ.ID}.chainInfoPath()) {
+		info, err := LoadChainInfo(basePath, succ.ID)
+		if err != nil {
+			return fmt.Errorf("reading %s chain info: %s", succ, err)
+		}
+		if info.InitialHeight > 1 && info.InitialHeight != u.HaltHeight+1 {
+			return fmt.Errorf("%s starts at height %d, it does not continue from halt height %d", succ, info.InitialHeight, u.HaltHeight)
+		}
+	}
+	return nil
+}
+
+// LinkChains records an upgrade in the lineage of both chains. Linking
+// chains that are already linked to other chains is an error, recording the
+// same link again updates its details.
+func LinkChains(basePath string, u Upgrade, logger log.Logger) (err error) {
+	if err = u.Validate(basePath); err != nil {
+		return
+	}
+	pred, err := LoadLineage(basePath, u.Predecessor)
+	if err != nil {
+		return fmt.Errorf("loading %s lineage: %s", u.Predecessor, err)
+	}
+	succ, err := LoadLineage(basePath, u.Successor)
+	if err != nil {
+		return fmt.Errorf("loading %s lineage: %s", u.Successor, err)
+	}
+	if s := pred.Successor; s != nil && s.Successor != u.Successor {
+		return fmt.Errorf("%s is already succeeded by %s", u.Predecessor, s.Successor)
+	}
+	if p := succ.Predecessor; p != nil && p.Predecessor != u.Predecessor {
+		return fmt.Errorf("%s already succeeds %s", u.Successor, p.Predecessor)
+	}
+	pred.Successor, succ.Predecessor = &u, &u
+	if err = utils.ToJSON(repoDir{basePath, u.Predecessor}.lineagePath(), pred); err != nil {
+		return
+	}
+	if err = utils.ToJSON(repoDir{basePath, u.Successor}.lineagePath(), succ); err != nil {
+		return
+	}
+	logger.Debug("chains linked", "predecessor", u.Predecessor, "successor", u.Successor, "halt-height", u.HaltHeight)
+	return
+}
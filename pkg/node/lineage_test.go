@@ -0,0 +1,56 @@
+package node
+
+import (
+	"os"
+	"testing"
+
+	"github.com/jackzampolin/cosmos-registrar/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/tendermint/tendermint/libs/log"
+)
+
+func TestLinkChains(t *testing.T) {
+	registry := t.TempDir()
+	for _, id := range []string{"test-1", "test-2", "test-3", "other"} {
+		assert.Nil(t, os.MkdirAll(repoDir{registry, id}.chainPath(), 0700))
+	}
+	assert.Nil(t, utils.ToJSON(repoDir{registry, "test-3"}.chainInfoPath(), ChainInfo{ChainID: "test-3", InitialHeight: 201}))
+
+	for _, u := range []Upgrade{
+		{Predecessor: "test-1", Successor: "test-1", HaltHeight: 10},
+		{Predecessor: "test-2", Successor: "test-1", HaltHeight: 10},
+		{Predecessor: "test-1", Successor: "test-2"},
+		{Predecessor: "test-1", Successor: "test-4", HaltHeight: 10},
+		{Predecessor: "../test-1", Successor: "test-2", HaltHeight: 10},
+		// test-3 starts at height 201
+		{Predecessor: "test-2", Successor: "test-3", HaltHeight: 100},
+	} {
+		assert.NotNil(t, LinkChains(registry, u, log.NewNopLogger()), u)
+	}
+
+	u := Upgrade{Predecessor: "test-1", Successor: "test-2", HaltHeight: 100, Name: "v2"}
+	assert.Nil(t, LinkChains(registry, u, log.NewNopLogger()))
+	assert.Nil(t, LinkChains(registry, Upgrade{Predecessor: "test-2", Successor: "test-3", HaltHeight: 200}, log.NewNopLogger()))
+	l, err := LoadLineage(registry, "test-2")
+	assert.Nil(t, err)
+	assert.Equal(t, &u, l.Predecessor)
+	assert.Equal(t, "test-3", l.Successor.Successor)
+	l, err = LoadLineage(registry, "test-1")
+	assert.Nil(t, err)
+	assert.Nil(t, l.Predecessor)
+	assert.Equal(t, &u, l.Successor)
+
+	// the same link can be updated, not replaced by a different one
+	u.Name = "v2-upgrade"
+	assert.Nil(t, LinkChains(registry, u, log.NewNopLogger()))
+	l, err = LoadLineage(registry, "test-1")
+	assert.Nil(t, err)
+	assert.Equal(t, "v2-upgrade", l.Successor.Name)
+	assert.NotNil(t, LinkChains(registry, Upgrade{Predecessor: "test-1", Successor: "test-3", HaltHeight: 200}, log.NewNopLogger()))
+	assert.NotNil(t, LinkChains(registry, Upgrade{Predecessor: "other", Successor: "test-2", HaltHeight: 100}, log.NewNopLogger()))
+
+	// no lineage recorded
+	l, err = LoadLineage(registry, "other")
+	assert.Nil(t, err)
+	assert.Equal(t, &Lineage{}, l)
+}
@@ -2,16 +2,14 @@ package node
 
 import (
 	"bufio"
-	"bytes"
-	"compress/gzip"
 	"context"
-	"crypto/md5"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math/rand"
+	"net/http"
 	"os"
 	"path"
 	"regexp"
@@ -20,18 +18,16 @@ import (
 	"sync"
 	"time"
 
+	registrar "github.com/jackzampolin/cosmos-registrar/pkg/config"
 	"github.com/jackzampolin/cosmos-registrar/pkg/utils"
-	tmjson "github.com/tendermint/tendermint/libs/json"
 	"github.com/tendermint/tendermint/libs/log"
 	rpchttp "github.com/tendermint/tendermint/rpc/client/http"
 	ctypes "github.com/tendermint/tendermint/rpc/core/types"
 	libclient "github.com/tendermint/tendermint/rpc/jsonrpc/client"
-	"github.com/tendermint/tendermint/types"
 	"golang.org/x/sync/errgroup"
 )
 
 var (
-	gen    *ctypes.ResultGenesis
 	commit *ctypes.ResultCommit
 	eg     errgroup.Group
 )
@@ -42,6 +38,10 @@ func Client(rpcAddress string) (*rpchttp.HTTP, error) {
 	if err != nil {
 		return nil, err
 	}
+	// clients are created per request, don't leave idle connections around
+	if t, ok := httpClient.Transport.(*http.Transport); ok {
+		t.DisableKeepAlives = true
+	}
 
 	rpcClient, err := rpchttp.NewWithClient(rpcAddress, "/websocket", httpClient)
 	if err != nil {
@@ -103,6 +103,7 @@ func LoadPeers(basePath, chainID, rpcAddress string, logger log.Logger) (peers m
 	peers = make(map[string]*Peer)
 	// map them to a map
 	for _, p := range peerList {
+		p := p
 		peers[p.ID] = &p
 	}
 	return
@@ -126,202 +127,263 @@ func SavePeers(basePath, chainID string, peers map[string]*Peer, logger log.Logg
 	return
 }
 
-func SaveLightRoots(basePath, chainID string, lr *LightRoot, logger log.Logger) (err error) {
+// LoadLightRoots load the light root history of a chain, oldest first
+func LoadLightRoots(basePath, chainID string) (lrh LightRootHistory, err error) {
 	repoRoot := repoDir{basePath, chainID}
 	f, err := os.Open(repoRoot.heights())
 	if err != nil {
 		return
 	}
-	r := bufio.NewReader(f)
-	lrh, err := parseLightRootHistory(r)
+	defer f.Close()
+	return parseLightRootHistory(bufio.NewReader(f))
+}
+
+// SaveLightRoots appends a light root to the history of a chain and applies
+// the retention policy to the result
+func SaveLightRoots(basePath, chainID string, lr *LightRoot, policy RetentionPolicy, logger log.Logger) (err error) {
+	lrh, err := LoadLightRoots(basePath, chainID)
 	if err != nil {
 		return
 	}
 
 	lrh = append(lrh, *lr)
-	err = utils.ToJSON(repoRoot.heights(), lrh)
-	return
+	kept := policy.Apply(lrh)
+	if pruned := len(lrh) - len(kept); pruned > 0 {
+		logger.Debug("pruned light roots", "chainID", chainID, "pruned", pruned, "policy", policy)
+	}
+	return writeLightRoots(basePath, chainID, kept)
 }
 
-func contactPeer(p *Peer, np *NodePool, wg *sync.WaitGroup, logger log.Logger) {
-	defer wg.Done()
-	client, e := Client(p.Address)
-	ctx := context.Background()
-
-	if e != nil {
-		logger.Error("error creating tendermint client: %s", e)
-		return
-	}
+func writeLightRoots(basePath, chainID string, lrh LightRootHistory) error {
+	repoRoot := repoDir{basePath, chainID}
+	return utils.ToJSON(repoRoot.heights(), lrh)
+}
 
-	// TODO: in a more advanced version of this tool,
-	// this would crawl the network a couple of hops
-	// and find more peers
+// RefreshPeers crawls the network starting from the known peers, following
+// the peers each node reports in /net_info up to opts.MaxDepth hops and
+// contacting at most opts.MaxPeers distinct nodes. Discovered peers are
+// contacted on the rpc address they advertise, and the address that answered
+// is stored in the returned peers. Peers disagreeing with the checkpoints in
+// opts are returned flagged as forked and not reachable. The IDs of the peers
+// the crawl tried to contact, reachable or not, are returned sorted. Requests
+// are run through s and stop when ctx is done.
+func RefreshPeers(ctx context.Context, s *Scheduler, peers map[string]*Peer, opts CrawlOptions, logger log.Logger) (peersReachable map[string]*Peer, contacted []string) {
+	c := newCrawler(s, opts, logger)
+	c.crawl(ctx, peers)
+	peersReachable = c.np.nodes
+	for id := range c.contacted {
+		contacted = append(contacted, id)
+	}
+	sort.Strings(contacted)
+	return
+}
 
-	netInfo, err := client.NetInfo(ctx)
-	if err != nil {
-		return
-	}
-	logger.Debug("GET /net_info", "rpc-addr", p.Address)
-
-	// The peer responded, so we know it's up and can add it to the reachable list.
-	np.AddNode(p.ID, p)
-
-	// Now we consider the peers that this peer reported
-	for _, p := range netInfo.Peers {
-		peer := &Peer{
-			ID:                string(p.NodeInfo.DefaultNodeID),
-			Address:           fmt.Sprintf("http://%s:26657", p.RemoteIP),
-			IsSeed:            false,
-			LastContactHeight: 0,
-			LastContactDate:   time.Time{},
-			UpdatedAt:         time.Now(),
-			Reachable:         false,
+// targetHeight asks a random sample of the peers for their latest block
+// height and returns the median height minus the safety margin of opts.
+// Unreachable, forked and impersonated peers are not sampled. Peers on
+// another chain, still catching up or failing to answer are ignored, as are
+// the ones farther than opts.MaxDeviation from the median of all the sampled
+// heights, so a single stale or malicious peer cannot choose the height.
+func targetHeight(ctx context.Context, s *Scheduler, peers map[string]*Peer, chainID string, opts HeightOptions, logger log.Logger) (h int64, err error) {
+	// the peers are sampled at random, so which peers are asked cannot be
+	// chosen by picking their IDs
+	sample := []*Peer{}
+	for _, p := range peers {
+		if p.rpcUsable() {
+			sample = append(sample, p)
 		}
-		// reach out to the peers of the peer and record if they're at
-		// least up
-		go up(ctx, peer, np, wg, logger)
-		wg.Add(1)
 	}
-}
-
-func up(ctx context.Context, peer *Peer, np *NodePool, wg *sync.WaitGroup, logger log.Logger) {
-	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
-	defer cancel()
-	defer wg.Done()
-
-	peer.Contact(ctx, logger)
-	if peer.Reachable {
-		np.AddNode(peer.ID, peer)
+	rand.New(rand.NewSource(time.Now().UnixNano())).Shuffle(len(sample), func(i, j int) {
+		sample[i], sample[j] = sample[j], sample[i]
+	})
+	if opts.Samples > 0 && len(sample) > opts.Samples {
+		sample = sample[:opts.Samples]
 	}
-}
 
-// RefreshPeers asks a peer to give its list of peers, then tries to contact
-// them on 26657 to see if they're up.
-func RefreshPeers(peers map[string]*Peer, logger log.Logger) (peersReachable map[string]*Peer) {
-	// for each peer available
-	// in the list, contact the known peers
-	// and add them to the channel
-	np := NewNodePool()
-	wg := sync.WaitGroup{}
-
-	for _, p := range peers {
-		go contactPeer(p, np, &wg, logger)
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		heights = map[string]int64{}
+	)
+	for _, p := range sample {
+		p := p
 		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ph, err := fetchLatestHeight(ctx, s, p, chainID, logger)
+			if err != nil {
+				logger.Debug("Peer could not tell us the latest block height", "peer", p.Address, "error", err)
+				return
+			}
+			mu.Lock()
+			heights[p.ID] = ph
+			mu.Unlock()
+		}()
 	}
 	wg.Wait()
-
-	// np contains all peers that had a reachable 26657. Simply add them into
-	// the answer.
-	peersReachable = np.nodes
-	return
-}
-
-// getLatestBlockHeight cycles through the list of peers, calling
-// mustGeTLatestBlockHeight and only proceeding to the next peer if there is a
-// network error
-func getLatestBlockHeight(peers map[string]*Peer, chainID string, logger log.Logger) (latestBlockHeight int64, err error) {
-	// Transform map into list of peers
-	vs := []*Peer{}
-	for _, v := range peers {
-		vs = append(vs, v)
+	if err = ctx.Err(); err != nil {
+		return 0, err
+	}
+	if len(heights) == 0 {
+		return 0, fmt.Errorf("update light roots: no peer could tell us the latest block height")
 	}
 
-	for i := 0; i < len(vs); i++ {
-		latestBlockHeight, err = mustGetLatestBlockHeight(vs[i], chainID, logger)
-		if err == nil {
-			return latestBlockHeight, nil
+	all := make([]int64, 0, len(heights))
+	for _, ph := range heights {
+		all = append(all, ph)
+	}
+	median := medianHeight(all)
+	kept := []int64{}
+	for id, ph := range heights {
+		if opts.MaxDeviation > 0 && (ph-median > opts.MaxDeviation || median-ph > opts.MaxDeviation) {
+			logger.Info("peer latest block height is too far from the others", "peer", id, "height", ph, "median", median)
+			continue
 		}
-		logger.Debug("Peer could not tell us the latest block height", "peer", vs[i].Address)
+		kept = append(kept, ph)
+	}
+	h = medianHeight(kept) - opts.SafetyMargin
+	if h < 1 {
+		return 0, fmt.Errorf("update light roots: the median latest block height %d is within the safety margin of %d blocks", medianHeight(kept), opts.SafetyMargin)
 	}
-	return 0, fmt.Errorf("update light roots: no peer could tell us the latest block height")
+	logger.Debug("light root height chosen", "height", h, "peers", len(kept), "ignored", len(heights)-len(kept))
+	return h, nil
 }
 
-// mustGetLatestBlockHeight retries GET /status until the node reports a correct latest block height
-func mustGetLatestBlockHeight(peer *Peer, chainID string, logger log.Logger) (latestBlockHeight int64, err error) {
+// fetchLatestHeight asks a peer for its latest block height with GET
+// /status, retrying while the peer is catching up. It fails if the peer is
+// on another chain, can't be reached or is still catching up after the
+// retries.
+func fetchLatestHeight(ctx context.Context, s *Scheduler, peer *Peer, chainID string, logger log.Logger) (latestBlockHeight int64, err error) {
 	retryCount := 5
-	ctx := context.Background()
-	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
 	ticker := time.NewTicker(200 * time.Millisecond)
 	defer ticker.Stop()
-	defer cancel()
 
 	client, err := Client(peer.Address)
 	if err != nil {
-		logger.Error("error creating tendermint client: %s", err)
+		return 0, fmt.Errorf("error creating tendermint client: %s", err)
 	}
 
-	// If the node is catching up, retry up to retryCount times. Otherwise, if
-	// the connection fails because of network error, or node has different
-	// chainID, return error immediately.
 	for n := 0; n <= retryCount; n++ {
-		<-ticker.C
+		if n > 0 {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			}
+		}
 		logger.Debug("GET /status to get latest block height", "peer", peer.Address)
-		stat, err := client.Status(ctx)
-		switch {
-		case err != nil:
-			logger.Error("error fetching client status", "error", err)
-			return 0, err
-		case stat.NodeInfo.Network != chainID:
-			logger.Error("node(%s) is on chain(%s) not configured chain(%s)", peer.Address, stat.NodeInfo.Network, chainID)
+		var (
+			stat    *ctypes.ResultStatus
+			statErr error
+		)
+		if err = s.Do(ctx, func(ctx context.Context) {
+			stat, statErr = client.Status(ctx)
+		}); err != nil {
 			return 0, err
 		}
-		if !stat.SyncInfo.CatchingUp {
-			latestBlockHeight = stat.SyncInfo.LatestBlockHeight
-			break
+		switch {
+		case statErr != nil:
+			return 0, fmt.Errorf("error fetching client status: %s", statErr)
+		case stat.NodeInfo.Network != chainID:
+			return 0, fmt.Errorf("node(%s) is on chain(%s) not configured chain(%s)", peer.Address, stat.NodeInfo.Network, chainID)
+		case !stat.SyncInfo.CatchingUp:
+			return stat.SyncInfo.LatestBlockHeight, nil
 		}
 	}
-	return latestBlockHeight, nil
+	return 0, fmt.Errorf("node(%s) still catching up", peer.Address)
 }
 
-// UpdateLightRoots asks a set a reachable peers for the blockhash at a
-// specific height, and ensures they all agree. If it cannot find a majority
-// answer, it returns an error
-func UpdateLightRoots(chainID string, peers map[string]*Peer, logger log.Logger) (lr *LightRoot, err error) {
-	// Choose a random peer to provide the latest block height
-	h, err := getLatestBlockHeight(peers, chainID, logger)
+// UpdateLightRoots asks a set of reachable peers for the blockhash at a
+// specific height and picks the answer the peers agree on according to the
+// agreement policy. The peers that reported a different answer are returned
+// as dissenters. Unreachable, forked and impersonated peers are ignored, and
+// peers disagreeing with the checkpoints in opts are flagged as forked. If
+// trusted is not nil the new light root is verified with the light client
+// protocol starting from it, using the agreeing peers as source. If the peers
+// don't reach an agreement, or the verification fails, it returns an error.
+// When the trusted root expired and opts.Reanchor is set the agreed root is
+// returned without verification.
+func UpdateLightRoots(ctx context.Context, s *Scheduler, chainID string, peers map[string]*Peer, trusted *LightRoot, opts LightRootOptions, logger log.Logger) (lr *LightRoot, dissenters []string, err error) {
+	// the height of the new light root is agreed on by a sample of the peers
+	h, err := targetHeight(ctx, s, peers, chainID, opts.Height, logger)
 	if err != nil {
-		logger.Error("Couldn't get latest block height to update light root history", err)
-		return nil, err
+		logger.Error("Couldn't get latest block height to update light root history", "error", err)
+		return nil, nil, err
 	}
 
 	wg := sync.WaitGroup{}
 	nlr := NewLightRootResults()
 	for _, peer := range peers {
-		wg.Add(1)
-		go func(peer *Peer, lrr *LightRootResults, logger log.Logger) {
-			defer wg.Done()
-			ctx := context.Background()
-			ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
-			defer cancel()
-
-			client, e := Client(peer.Address)
-			if e != nil {
-				logger.Error("error creating tendermint client: %s", e)
+		if !peer.rpcUsable() {
+			continue
+		}
+		peer := peer
+		s.Go(ctx, &wg, func(ctx context.Context) {
+			if err := opts.Checkpoints.verifyNode(ctx, peer.Address); errors.Is(err, ErrForked) {
+				logger.Info("peer is on a different fork", "peer", peer.Address, "peerID", peer.ID, "error", err)
+				peer.Forked, peer.Reachable = true, false
+				return
+			}
+			client, err := Client(peer.Address)
+			if err != nil {
+				logger.Error("error creating tendermint client", "peer", peer.Address, "error", err)
+				return
 			}
 			logger.Debug("Asking peer for commit at", "peer", peer.Address, "height", h)
-			commit, err = client.Commit(ctx, &h)
+			commit, err := client.Commit(ctx, &h)
 			if err != nil {
 				logger.Error("error getting light roots from", "peer", peer.Address, "error", err)
 				return
 			}
 			lr := NewLightRoot(commit.SignedHeader)
-			lrr.AddResult(peer.ID, lr)
+			nlr.AddResult(peer.ID, lr)
 			logger.Debug("Updated light roots from", "peer", peer.Address, "peerID", peer.ID, "lightroot", lr)
-		}(peer, nlr, logger)
+		})
 	}
 	wg.Wait()
+	if err = ctx.Err(); err != nil {
+		return nil, nil, err
+	}
 
-	if !nlr.Same() {
-		return nil, fmt.Errorf("peers reported different lightroot hashes for height %v, peerMap: %v", h, nlr)
+	lr, dissenters, err = nlr.Agree(opts.Agreement)
+	if err != nil {
+		return nil, nil, fmt.Errorf("peers did not agree on the lightroot for height %v (%s): %s", h, opts.Agreement, err)
+	}
+	if len(dissenters) > 0 {
+		logger.Info("peers reported a different lightroot", "height", h, "dissenters", strings.Join(dissenters, ","))
 	}
 
-	// Return a random LightRootResult (they're all the same at this point)
-	return nlr.RandomElement(), nil
+	if trusted == nil {
+		logger.Info("no trusted light root, skipping verification", "chainID", chainID, "height", h)
+		return lr, dissenters, nil
+	}
+	src := &lightBlockSource{chainID: chainID, sched: s, logger: logger}
+	for id, p := range peers {
+		if p.rpcUsable() && !utils.ContainsStr(&dissenters, id) {
+			src.peers = append(src.peers, p)
+		}
+	}
+	if err = verifyLightRoot(ctx, src, trusted, lr, opts, logger); err != nil {
+		if !opts.Reanchor || !errors.Is(err, ErrTrustExpired) {
+			return nil, nil, fmt.Errorf("light root at height %d failed verification: %w", h, err)
+		}
+		logger.Error("THE TRUSTED LIGHT ROOT EXPIRED, the new light root is NOT verified and is accepted on the agreement of the peers alone",
+			"chainID", chainID, "height", h, "trusted-height", trusted.TrustHeight, "error", err)
+		return lr, dissenters, nil
+	}
+	logger.Debug("light root verified", "chainID", chainID, "height", h, "trusted-height", trusted.TrustHeight)
+	return lr, dissenters, nil
 }
 
 // DumpInfo connect to ad node and dumps the info about
-// that chain into a folder
-func DumpInfo(basePath, chainID, rpcAddress string, logger log.Logger) (err error) {
+// that chain into a folder. If genesisFile is not empty the genesis is read
+// from it, and verified against the node, instead of being downloaded. The
+// build information of the binary, if any, is recorded with the software
+// version of the node.
+func DumpInfo(basePath, chainID, rpcAddress, genesisFile string, build *registrar.Binary, logger log.Logger) (err error) {
+	if _, err = ParseChainID(chainID); err != nil {
+		return
+	}
 	client, err := Client(rpcAddress)
 	if err != nil {
 		err = fmt.Errorf("error creating tendermint client: %s", err)
@@ -354,13 +416,27 @@ func DumpInfo(basePath, chainID, rpcAddress string, logger log.Logger) (err erro
 		logger.Info("Node did not report its Tendermint version, there may be compatibility problems")
 	}
 
-	eg.Go(func() error {
-		if stat.NodeInfo.Network == "cosmoshub-4" {
-			gen, err = cosmoshub4Workaround(ctx, client)
-		} else {
-			gen, err = client.Genesis(ctx)
+	cps, err := LoadCheckpoints(basePath, chainID)
+	if err != nil {
+		return fmt.Errorf("loading checkpoints: %s", err)
+	}
+	if err = cps.Verify(ctx, client, stat.SyncInfo.EarliestBlockHeight, stat.SyncInfo.LatestBlockHeight); err != nil {
+		return fmt.Errorf("node(%s) checkpoints: %s", rpcAddress, err)
+	}
+
+	// the genesis is written when the chain is first claimed, claiming it
+	// again checks that the genesis still gives the registered files
+	repoRoot := repoDir{basePath, chainID}
+	registered := utils.PathExists(repoRoot.manifestPath()) || utils.PathExists(repoRoot.genesisGzPath())
+	var genesis io.ReadCloser
+	eg.Go(func() (err error) {
+		if genesisFile != "" {
+			if genesis, err = OpenGenesisFile(genesisFile); err != nil {
+				return fmt.Errorf("genesis file: %s", err)
+			}
+			return nil
 		}
-		if err != nil {
+		if genesis, err = DownloadGenesis(ctx, rpcAddress, logger); err != nil {
 			return fmt.Errorf("genesis file: %s", err)
 		}
 		logger.Debug("GET /genesis", "rpc-addr", rpcAddress)
@@ -377,47 +453,58 @@ func DumpInfo(basePath, chainID, rpcAddress string, logger log.Logger) (err erro
 		return nil
 	})
 
-	if err = eg.Wait(); err != nil {
+	err = eg.Wait()
+	if genesis != nil {
+		defer genesis.Close()
+	}
+	if err != nil {
 		err = fmt.Errorf("fetching: %s", err)
 		return
 	}
 	// fetch data
-	repoRoot := repoDir{basePath, chainID}
 	if err = createDirIfNotExist(repoRoot.chainPath(), logger); err != nil {
 		return
 	}
 	if err = createDirIfNotExist(repoRoot.lrpath(), logger); err != nil {
 		return
 	}
+	if _, err = SeedCheckpoints(basePath, chainID); err != nil {
+		return fmt.Errorf("seeding checkpoints: %s", err)
+	}
+	if registered {
+		if err = CheckGenesis(basePath, chainID, genesis, logger); err != nil {
+			return fmt.Errorf("genesis differs from the registered one: %s", err)
+		}
+	} else if err = storeVerifiedGenesis(ctx, client, basePath, chainID, genesis, genesisFile != "", logger); err != nil {
+		return
+	}
+	eg.Go(func() error {
+		// chain.json is a convenience for the registry consumers, a genesis
+		// it cannot summarize does not prevent the claim
+		if err := WriteChainInfo(basePath, chainID, logger); err != nil {
+			logger.Error("failed to write the chain info", "chainID", chainID, "err", err)
+		}
+		return nil
+	})
 
 	// Initialize a list of historical LightRoots
 	lrh := make([]*LightRoot, 1)
 	lrh[0] = NewLightRoot(commit.SignedHeader)
+	lrh[0].Peers = []string{string(stat.NodeInfo.ID())}
 	lrhBytes, err := json.MarshalIndent(lrh, "", "  ")
 	if err != nil {
 		return err
 	}
 	eg.Go(updateFileGo(repoRoot.heights(), lrhBytes, logger))
 
-	// TODO: not sure about this one, but we should be able to get the node version from the rpc
-	// eg.Go(updateFileGo(repoRoot.binariesPath(), config.Binary(), logger))
-
 	eg.Go(func() error {
-		if _, err = os.Stat(repoRoot.genesisPath()); os.IsNotExist(err) {
-			sum, write, err := sortedGenesis(gen.Genesis)
-			if err != nil {
-				return fmt.Errorf("sorting genesis file: %s", err)
-			}
-
-			if err = writeFile(repoRoot.genesisSumPath(), []byte(sum), logger); err != nil {
-				return err
-			}
-			if err = writeGzFile(repoRoot.genesisPath(), write, logger); err != nil {
-				return err
-			}
+		v, err := FetchNodeVersion(ctx, rpcAddress)
+		if err != nil {
+			return err
 		}
-		return nil
+		return UpdateBinaries(basePath, chainID, build, []NodeVersion{v}, stat.SyncInfo.LatestBlockHeight, logger)
 	})
+
 	eg.Go(func() error {
 		updateTime := time.Now()
 		seedNode := Peer{
@@ -426,14 +513,20 @@ func DumpInfo(basePath, chainID, rpcAddress string, logger log.Logger) (err erro
 			Address:           rpcAddress,
 			ID:                fmt.Sprint(stat.NodeInfo.ID()),
 			LastContactHeight: stat.SyncInfo.LatestBlockHeight,
+			EarliestHeight:    stat.SyncInfo.EarliestBlockHeight,
 			LastContactDate:   updateTime,
 			UpdatedAt:         updateTime,
 		}
-		out, err := json.Marshal([]Peer{seedNode})
+		pctx, cancel := context.WithTimeout(ctx, DefaultSchedulerOptions().RequestTimeout)
+		seedNode.contactP2P(pctx, stat.NodeInfo.ListenAddr)
+		cancel()
+		// claiming the chain again keeps the peers found by the updates
+		peers, err := LoadPeerStore(basePath, chainID, DefaultPeerStoreOptions(), logger)
 		if err != nil {
-			return fmt.Errorf("marshaling peers: %s", err)
+			return fmt.Errorf("loading peers: %s", err)
 		}
-		return writeFile(repoRoot.peersPath(), out, logger)
+		peers.Add(&seedNode, updateTime)
+		return peers.Save(basePath, chainID, logger)
 	})
 
 	err = eg.Wait()
@@ -449,9 +542,46 @@ type Peer struct {
 	LastContactDate   time.Time `json:"last_contact_date,omitempty"`
 	UpdatedAt         time.Time `json:"updated_at,omitempty"`
 	Reachable         bool      `json:"reachable,omitempty"`
+	IntroducedBy      string    `json:"introduced_by,omitempty"`
+	// Forked is set when the peer disagrees with a checkpoint of the chain
+	Forked bool `json:"forked,omitempty"`
+	// P2PAddr is the host:port the peer accepts p2p connections on, the port
+	// it reports on the host it is known at, P2PReachable tells if it
+	// accepted a tcp connection
+	P2PAddr      string `json:"p2p_address,omitempty"`
+	P2PReachable bool   `json:"p2p_reachable,omitempty"`
+	// remoteIP is the ip the peer that introduced it during the crawl sees
+	// it connected from
+	remoteIP string
+	// Identity is the outcome of the last verification of the node ID of
+	// the peer against its p2p key, empty if it was never verified
+	Identity string `json:"identity,omitempty"`
+	// EarliestHeight is the lowest block height the peer has, CatchingUp
+	// tells if it was syncing when it was last contacted
+	EarliestHeight int64 `json:"earliest_height,omitempty"`
+	CatchingUp     bool  `json:"catching_up,omitempty"`
+	// Classes are the classes of the peer, see ClassifyPeers
+	Classes []string `json:"classes,omitempty"`
+	// FirstSeen and LastSeen are the first and the last time a crawl found
+	// the peer, the outcome of the contacts since it was first seen is kept
+	// by the PeerStore
+	FirstSeen           time.Time `json:"first_seen,omitempty"`
+	LastSeen            time.Time `json:"last_seen,omitempty"`
+	SuccessRatio        float64   `json:"success_ratio"`
+	Contacts            int       `json:"contacts,omitempty"`
+	ConsecutiveFailures int       `json:"consecutive_failures,omitempty"`
 }
 
-func (p *Peer) Contact(ctx context.Context, logger log.Logger) {
+// rpcUsable tells if the rpc of a peer can be asked for light roots: it has
+// one, it was reachable at the last contact and it is neither forked nor
+// impersonated
+func (p Peer) rpcUsable() bool {
+	return p.Address != "" && p.Reachable && !p.Forked && p.Identity != IdentityImpersonated
+}
+
+// Contact checks if the peer is reachable and agrees with the checkpoints of
+// the chain, a peer that does not is flagged as forked
+func (p *Peer) Contact(ctx context.Context, cps Checkpoints, logger log.Logger) {
 	client, err := Client(p.Address)
 	if err != nil {
 		p.UpdatedAt = time.Now()
@@ -465,8 +595,19 @@ func (p *Peer) Contact(ctx context.Context, logger log.Logger) {
 		p.Reachable = false
 		return
 	}
+	if err = cps.Verify(ctx, client, res.SyncInfo.EarliestBlockHeight, res.SyncInfo.LatestBlockHeight); err != nil {
+		logger.Debug("Peer failed the checkpoints", "peer", p.Address, "error", err)
+		p.UpdatedAt = time.Now()
+		p.Reachable = false
+		p.Forked = errors.Is(err, ErrForked)
+		return
+	}
 	logger.Debug("Confirmed reachable", "peer", p.Address)
+	p.contactP2P(ctx, res.NodeInfo.ListenAddr)
+	p.Forked = false
 	p.LastContactHeight = res.SyncInfo.LatestBlockHeight
+	p.EarliestHeight = res.SyncInfo.EarliestBlockHeight
+	p.CatchingUp = res.SyncInfo.CatchingUp
 	p.LastContactDate = time.Now()
 	p.UpdatedAt = time.Now()
 	p.Reachable = true
@@ -477,13 +618,21 @@ type repoDir struct {
 	chainID string
 }
 
-func (r repoDir) chainPath() string      { return path.Join(r.dir, r.chainID) }
-func (r repoDir) genesisPath() string    { return path.Join(r.chainPath(), "genesis.json") }
-func (r repoDir) genesisSumPath() string { return path.Join(r.chainPath(), "genesis.json.sum") }
-func (r repoDir) lrpath() string         { return path.Join(r.chainPath(), "light-roots") }
-func (r repoDir) heights() string        { return path.Join(r.lrpath(), "heights.json") }
-
-func (r repoDir) peersPath() string { return path.Join(r.chainPath(), "peers.json") }
+func (r repoDir) chainPath() string        { return path.Join(r.dir, r.chainID) }
+func (r repoDir) genesisPath() string      { return path.Join(r.chainPath(), "genesis.json") }
+func (r repoDir) genesisGzPath() string    { return r.genesisPath() + ".gz" }
+func (r repoDir) genesisSumPath() string   { return path.Join(r.chainPath(), "genesis.json.sum") }
+func (r repoDir) genesisGzSumPath() string { return r.genesisGzPath() + ".sum" }
+func (r repoDir) lrpath() string           { return path.Join(r.chainPath(), "light-roots") }
+func (r repoDir) heights() string          { return path.Join(r.lrpath(), "heights.json") }
+func (r repoDir) retentionPath() string    { return path.Join(r.lrpath(), "retention.json") }
+
+func (r repoDir) manifestPath() string    { return path.Join(r.chainPath(), "genesis.manifest.json") }
+func (r repoDir) chainInfoPath() string   { return path.Join(r.chainPath(), "chain.json") }
+func (r repoDir) binariesPath() string    { return path.Join(r.chainPath(), "binaries.json") }
+func (r repoDir) peersPath() string       { return path.Join(r.chainPath(), "peers.json") }
+func (r repoDir) checkpointsPath() string { return path.Join(r.chainPath(), "checkpoints.json") }
+func (r repoDir) lineagePath() string     { return path.Join(r.chainPath(), "lineage.json") }
 
 func updateFileGo(pth string, payload []byte, log log.Logger) func() error {
 	return func() (err error) {
@@ -505,23 +654,6 @@ func writeFile(pth string, payload []byte, log log.Logger) (err error) {
 	return nil
 }
 
-func writeGzFile(pth string, payload []byte, log log.Logger) (err error) {
-	pth = strings.Join([]string{pth, ".gz"}, "")
-	log.Debug(fmt.Sprintf("writing path %s", path.Base(pth)))
-	f, err := os.Create(pth)
-	if err != nil {
-		return
-	}
-
-	zw := gzip.NewWriter(f)
-	_, err = zw.Write(payload)
-	if err != nil {
-		return fmt.Errorf("writing %s: %s", pth, err)
-	}
-	defer zw.Close()
-	return nil
-}
-
 func createDirIfNotExist(pth string, log log.Logger) (err error) {
 	if _, err = os.Stat(pth); os.IsNotExist(err) {
 		log.Debug("creating directory", "dir", path.Base(pth))
@@ -532,93 +664,28 @@ func createDirIfNotExist(pth string, log log.Logger) (err error) {
 	return nil
 }
 
-func sortedGenesis(gen *types.GenesisDoc) (sum string, indented []byte, err error) {
-	// prepare to sort
-	if indented, err = tmjson.Marshal(gen); err != nil {
-		return
-	}
-
-	// sort
-	c, err := types.GenesisDocFromJSON(indented)
-	if err != nil {
-		return
-	}
-
-	// indent
-	if indented, err = tmjson.MarshalIndent(c, "", "  "); err != nil {
-		return
-	}
-
-	// sum
-	sum = fmt.Sprintf("%x", sha256.Sum256(indented))
-	return
-}
-
-// cosmoshub4Workaround is a workaround for not being able to get cosmoshub-4's
-// genesis from a node, because it is too large (problem with tendermint 0.34,
-// should be fixed with 0.35)
-func cosmoshub4Workaround(ctx context.Context, client *rpchttp.HTTP) (gen *ctypes.ResultGenesis, err error) {
-	expected := []struct {
-		Height  int64
-		AppHash string
-	}{
-		{5200791, "E3B0C44298FC1C149AFBF4C8996FB92427AE41E4649B934CA495991B7852B855"},
-		{6000000, "DCBA58D3825AE20BA8FA836AAF386497D8D18A837F4B06D51D67BD372763D4FB"},
-		{6282992, "101FCD443AAEDDE4904971810EC08EF44CA06C490E8C520483E02A55C6987FF7"},
-	}
-	for _, e := range expected {
-		commit, err := client.Commit(ctx, &e.Height)
-		if err != nil {
-			return nil, err
-		}
-
-		if commit.Header.AppHash.String() != e.AppHash {
-			return nil, fmt.Errorf("height %b had app hash %s, expected %s", e.Height, commit.Header.AppHash.String(), e.AppHash)
-		}
-	}
-
-	// Find and verify genesis.cosmoshub-4.json.gz in the current folder
-	dir, err := os.Getwd()
-	if err != nil {
-		return
-	}
-	println("cosmoshub4Workaround: looking for genesis.cosmoshub-4.json.gz in", dir)
-	gPath := path.Join(dir, "genesis.cosmoshub-4.json.gz")
-	f, err := os.Open(gPath)
-	if err != nil {
-		return
-	}
-	defer f.Close()
-	b, err := ioutil.ReadAll(f) // so we can read the file contents twice
-
-	hReader := bytes.NewReader(b)
-	h := md5.New()
-	if _, err := io.Copy(h, hReader); err != nil {
-		return nil, err
-	}
-	hActual := hex.EncodeToString(h.Sum(nil))
-	hExpected := "a4216a3cae68e9190d0757c90bcb1f1b"
-	if string(hActual) != hExpected {
-		return nil, fmt.Errorf("%s has md5 of %s, expected %s", gPath, hActual, hExpected)
-	}
-
-	gzReader := bytes.NewReader(b)
-	gr, err := gzip.NewReader(gzReader)
+// storeVerifiedGenesis stores the genesis read from r and checks that it
+// is the genesis of the chain. Genesis files provided by the user are
+// verified against the node as well. The genesis is removed if it doesn't
+// belong to the chain.
+func storeVerifiedGenesis(ctx context.Context, client *rpchttp.HTTP, basePath, chainID string, r io.Reader, verify bool, logger log.Logger) (err error) {
+	doc, err := StoreGenesis(basePath, chainID, r, logger)
 	if err != nil {
-		return
+		return fmt.Errorf("storing genesis: %s", err)
 	}
-	defer gr.Close()
-
-	j, err := ioutil.ReadAll(gr)
-	if err != nil {
-		return
+	switch {
+	case doc.ChainID != chainID:
+		err = fmt.Errorf("the genesis is for chain %s", doc.ChainID)
+	case verify:
+		err = VerifyGenesisOnChain(ctx, client, doc, logger)
 	}
-	gDoc, err := types.GenesisDocFromJSON(j)
 	if err != nil {
-		return
+		removeGenesisParts(basePath, chainID)
+		os.Remove(repoDir{basePath, chainID}.genesisSumPath())
+		return fmt.Errorf("genesis file: %s", err)
 	}
-	gen = &ctypes.ResultGenesis{Genesis: gDoc}
-	return
+	logger.Debug("genesis stored", "chainID", chainID, "validators", len(doc.Validators))
+	return nil
 }
 
 func parseLightRootHistory(r io.Reader) (lrh LightRootHistory, err error) {
@@ -16,16 +16,6 @@ import (
 
 var online = flag.Bool("online", false, "perform tests that require a network connection")
 
-func TestCosmoshub4Workaround(t *testing.T) {
-	ctx := context.Background()
-	client, err := Client("https://rpc.cosmos.network:443")
-	assert.Nil(t, err)
-
-	gen, err = cosmoshub4Workaround(ctx, client)
-	fmt.Println("gen", gen)
-	assert.Nil(t, err)
-}
-
 // TestRefreshPeers is more of a dev harness, since it requires a network
 // connection and has no objectively correct result
 func TestRefreshPeers(t *testing.T) {
@@ -61,7 +51,7 @@ func TestRefreshPeers(t *testing.T) {
 		Reachable:         true,
 	}
 	pm := map[string]*Peer{peer1.ID: peer1, peer2.ID: peer2, peer3.ID: peer3}
-	peersReachable := RefreshPeers(pm, logger)
+	peersReachable, _ := RefreshPeers(context.Background(), NewScheduler(DefaultSchedulerOptions()), pm, DefaultCrawlOptions(), logger)
 	fmt.Println("original peers map", pm)
 
 	raw, err := json.MarshalIndent(peersReachable, "", "  ")
@@ -99,7 +89,7 @@ func TestUpdateLightRoots(t *testing.T) {
 		Reachable:         true,
 	}
 	pm := map[string]*Peer{peer1.ID: peer1, peer2.ID: peer2, peer3.ID: peer3}
-	_, err := UpdateLightRoots("cosmoshub-4", pm, logger)
+	_, _, err := UpdateLightRoots(context.Background(), NewScheduler(DefaultSchedulerOptions()), "cosmoshub-4", pm, nil, DefaultLightRootOptions(), logger)
 	assert.Nil(t, err)
 }
 
@@ -109,3 +99,102 @@ func TestParseLightRootHistory(t *testing.T) {
 	_, err := parseLightRootHistory(r)
 	assert.Nil(t, err)
 }
+
+func TestParseLightRootHistoryFormats(t *testing.T) {
+	testJSON := []byte(`[
+  {"trust-height":6766717,"trust-hash":"2DD62FE8D0358822D245C8C4AD91489DC0031CF35BE193CC561868DB79A51904"},
+  {"trust-height":"6766806","trust-hash":"C21AFE7C2AB4927497DD239568FB9F819120D70EAF254E970185F88502806F1E"},
+  {
+    "trust-height": 6766886,
+    "trust-hash": "A6B573B433D69ABC6F07216B572E21BE8DCF83CD037E8898B379F6978D3085DE",
+    "chain-id": "cosmoshub-4",
+    "time": "2021-06-18T17:01:02.123Z",
+    "app-hash": "E3B0C44298FC1C149AFBF4C8996FB92427AE41E4649B934CA495991B7852B855",
+    "validators-hash": "DCBA58D3825AE20BA8FA836AAF386497D8D18A837F4B06D51D67BD372763D4FB",
+    "next-validators-hash": "101FCD443AAEDDE4904971810EC08EF44CA06C490E8C520483E02A55C6987FF7",
+    "peers": ["a6f325ea73533648fd3176e612915a83e2a2572f", "cfd785a4224c7940e9a10f6c1ab24c343e923bec"]
+  }
+]`)
+	lrh, err := parseLightRootHistory(bytes.NewReader(testJSON))
+	assert.Nil(t, err)
+	assert.Len(t, lrh, 3)
+	assert.Equal(t, int64(6766717), lrh[0].TrustHeight)
+	assert.True(t, lrh[0].Time.IsZero())
+	assert.Equal(t, int64(6766806), lrh[1].TrustHeight)
+	assert.Equal(t, "cosmoshub-4", lrh[2].ChainID)
+	assert.Equal(t, time.Date(2021, 6, 18, 17, 1, 2, 123000000, time.UTC), lrh[2].Time)
+	assert.Len(t, lrh[2].Peers, 2)
+
+	// old entries are written back without the new fields
+	raw, err := json.Marshal(lrh[0])
+	assert.Nil(t, err)
+	assert.Equal(t, `{"trust-height":6766717,"trust-hash":"2DD62FE8D0358822D245C8C4AD91489DC0031CF35BE193CC561868DB79A51904"}`, string(raw))
+	// new entries survive a round trip
+	raw, err = json.Marshal(lrh[2])
+	assert.Nil(t, err)
+	var lr LightRoot
+	assert.Nil(t, json.Unmarshal(raw, &lr))
+	assert.Equal(t, lrh[2], lr)
+
+	for _, bad := range []string{`[{"trust-hash":"AA"}]`, `[{"trust-height":"x","trust-hash":"AA"}]`} {
+		_, err = parseLightRootHistory(bytes.NewReader([]byte(bad)))
+		assert.NotNil(t, err, bad)
+	}
+}
+
+func TestTargetHeight(t *testing.T) {
+	peers := map[string]*Peer{}
+	for id, h := range map[string]int64{"aaaa": 100, "bbbb": 101, "stale": 10, "liar": 1000000, "liar2": 2000000} {
+		peers[id] = newFakeNode(t, id, "test-1", h).Peer()
+	}
+	peers["other"] = newFakeNode(t, "other", "test-2", 500).Peer()
+	syncing := newFakeNode(t, "syncing", "test-1", 5000)
+	syncing.catchingUp = true
+	peers["syncing"] = syncing.Peer()
+	peers["forked"] = newFakeNode(t, "forked", "test-1", 5000).Peer()
+	peers["forked"].Forked = true
+	peers["down"] = &Peer{ID: "down", Address: "http://127.0.0.1:1"}
+
+	s := NewScheduler(DefaultSchedulerOptions())
+	opts := HeightOptions{SafetyMargin: 2, MaxDeviation: 50}
+	h, err := targetHeight(context.Background(), s, peers, "test-1", opts, log.NewNopLogger())
+	assert.Nil(t, err)
+	assert.Equal(t, int64(98), h)
+
+	// without the deviation limit the outliers move the median
+	h, err = targetHeight(context.Background(), s, peers, "test-1", HeightOptions{SafetyMargin: 2}, log.NewNopLogger())
+	assert.Nil(t, err)
+	assert.Equal(t, int64(99), h)
+
+	// the sample is taken at random
+	sampled := map[int64]bool{}
+	two := map[string]*Peer{"aaaa": peers["aaaa"], "liar": peers["liar"]}
+	for i := 0; i < 50 && len(sampled) < 2; i++ {
+		h, err = targetHeight(context.Background(), s, two, "test-1", HeightOptions{Samples: 1}, log.NewNopLogger())
+		assert.Nil(t, err)
+		sampled[h] = true
+	}
+	assert.Equal(t, map[int64]bool{100: true, 1000000: true}, sampled)
+
+	_, err = targetHeight(context.Background(), s, map[string]*Peer{"aaaa": peers["aaaa"]}, "test-1", HeightOptions{SafetyMargin: 100}, log.NewNopLogger())
+	assert.NotNil(t, err)
+	_, err = targetHeight(context.Background(), s, map[string]*Peer{"other": peers["other"], "down": peers["down"]}, "test-1", opts, log.NewNopLogger())
+	assert.NotNil(t, err)
+}
+
+func TestFetchLatestHeight(t *testing.T) {
+	s := NewScheduler(DefaultSchedulerOptions())
+	n := newFakeNode(t, "aaaa", "test-1", 42)
+	h, err := fetchLatestHeight(context.Background(), s, n.Peer(), "test-1", log.NewNopLogger())
+	assert.Nil(t, err)
+	assert.Equal(t, int64(42), h)
+
+	// a different chain is an error
+	_, err = fetchLatestHeight(context.Background(), s, n.Peer(), "test-2", log.NewNopLogger())
+	assert.NotNil(t, err)
+
+	// as is a node that does not catch up
+	n.catchingUp = true
+	_, err = fetchLatestHeight(context.Background(), s, n.Peer(), "test-1", log.NewNopLogger())
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,143 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/jackzampolin/cosmos-registrar/pkg/utils"
+)
+
+// The formats peers can be exported in, they are the values of the seeds
+// and persistent_peers settings of the tendermint configuration
+const (
+	ExportSeeds           = "seeds"
+	ExportPersistentPeers = "persistent-peers"
+)
+
+// defaultP2PPort is the tendermint p2p port assumed for the peers that don't
+// report one
+const defaultP2PPort = "26656"
+
+// p2pAddress returns the host:port a node accepts p2p connections on. Only
+// the port is read from the listen address of its node info, the host it
+// reports could point anywhere: host is the address the node is known at.
+func p2pAddress(listenAddr, host string) string {
+	_, port, ok := splitListenAddr(listenAddr)
+	if !ok || host == "" {
+		return ""
+	}
+	if port == "" {
+		port = defaultP2PPort
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// contactP2P records the p2p address of a reachable peer from the port of the
+// listen address it reports and checks that it accepts tcp connections. The
+// host is the ip the peer that introduced it sees it connected from, or else
+// the host of its rpc address.
+func (p *Peer) contactP2P(ctx context.Context, listenAddr string) {
+	host := p.remoteIP
+	if host == "" {
+		if u, err := url.Parse(p.Address); err == nil {
+			host = u.Hostname()
+		}
+	}
+	p.P2PAddr = p2pAddress(listenAddr, host)
+	p.checkP2P(ctx)
+}
+
+// checkP2P checks that the p2p address of a peer accepts tcp connections
+func (p *Peer) checkP2P(ctx context.Context) {
+	p.P2PReachable = false
+	if p.P2PAddr == "" {
+		return
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", p.P2PAddr)
+	if err != nil {
+		return
+	}
+	conn.Close()
+	p.P2PReachable = true
+}
+
+// P2PAddress returns the p2p address of the peer in the id@host:port format
+// used by the tendermint configuration. For peers registered before their
+// listen address was collected the host is the one of the rpc address and
+// the port is the default p2p port.
+func (p Peer) P2PAddress() string {
+	if p.ID == "" {
+		return ""
+	}
+	if p.P2PAddr != "" {
+		return fmt.Sprintf("%s@%s", p.ID, p.P2PAddr)
+	}
+	u, err := url.Parse(p.Address)
+	if err != nil || u.Hostname() == "" || p.ID == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s@%s", p.ID, net.JoinHostPort(u.Hostname(), defaultP2PPort))
+}
+
+// p2pUsable tells if the p2p address of a peer can be given to a node: it
+// has one, it was reachable the last time it was checked and it is not
+// impersonated
+func (p Peer) p2pUsable() bool {
+	return p.P2PAddress() != "" && (p.P2PAddr == "" || p.P2PReachable) && p.Identity != IdentityImpersonated
+}
+
+// SeedAddresses returns the p2p addresses of the seeds among the peers
+func SeedAddresses(peers []Peer) (addrs []string) {
+	for _, p := range peers {
+		if p.IsSeed && p.p2pUsable() {
+			addrs = append(addrs, p.P2PAddress())
+		}
+	}
+	return
+}
+
+// PersistentPeerAddresses returns the p2p addresses of at most n of the
+// best peers that are not seeds. The peers without rpc, whose height is not
+// known, come after the others.
+func PersistentPeerAddresses(peers []Peer, n int) (addrs []string) {
+	candidates, p2pOnly := []Peer{}, []Peer{}
+	for _, p := range peers {
+		switch {
+		case p.IsSeed || !p.p2pUsable():
+		case p.Address == "":
+			p2pOnly = append(p2pOnly, p)
+		default:
+			candidates = append(candidates, p)
+		}
+	}
+	sort.Slice(p2pOnly, func(i, j int) bool { return p2pOnly[i].ID < p2pOnly[j].ID })
+	for _, p := range append(BestPeers(candidates, n), p2pOnly...) {
+		if len(addrs) == n {
+			break
+		}
+		addrs = append(addrs, p.P2PAddress())
+	}
+	return
+}
+
+// ExportPeers returns the registered peers of a chain in one of the export
+// formats, as the comma separated list of p2p addresses the tendermint
+// configuration expects. At most n persistent peers are exported.
+func ExportPeers(basePath, chainID, format string, n int) (out string, err error) {
+	peers := []Peer{}
+	if err = utils.FromJSON(repoDir{basePath, chainID}.peersPath(), &peers); err != nil {
+		return "", fmt.Errorf("loading peers: %s", err)
+	}
+	switch format {
+	case ExportSeeds:
+		return strings.Join(SeedAddresses(peers), ","), nil
+	case ExportPersistentPeers:
+		return strings.Join(PersistentPeerAddresses(peers, n), ","), nil
+	}
+	return "", fmt.Errorf("unknown export format %q, expected %s or %s", format, ExportPersistentPeers, ExportSeeds)
+}
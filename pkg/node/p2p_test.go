@@ -0,0 +1,135 @@
+package node
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tendermint/tendermint/libs/log"
+)
+
+func TestP2PAddress(t *testing.T) {
+	tests := []struct {
+		listenAddr, host, want string
+	}{
+		{"tcp://0.0.0.0:26656", "1.2.3.4", "1.2.3.4:26656"},
+		// the reported host is not trusted
+		{"tcp://5.6.7.8:26666", "1.2.3.4", "1.2.3.4:26666"},
+		{"5.6.7.8:26666", "1.2.3.4", "1.2.3.4:26666"},
+		{"tcp://[::]:26656", "2001:db8::1", "[2001:db8::1]:26656"},
+		{"tcp://node.example.com", "1.2.3.4", "1.2.3.4:26656"},
+		{"tcp://localhost:26656", "", ""},
+		{"unix:///tmp/p2p.sock", "1.2.3.4", ""},
+		{"", "1.2.3.4", ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, p2pAddress(tt.listenAddr, tt.host), tt.listenAddr)
+	}
+}
+
+func TestCrawlP2PAddresses(t *testing.T) {
+	a := newFakeNode(t, "aaaa", "test-1", 10)
+	b := newFakeNode(t, "bbbb", "test-1", 10)
+	c := newFakeNode(t, "cccc", "test-1", 10)
+	a.Connect(b, c)
+	la := a.ListenP2P(t, nil)
+	lb := b.ListenP2P(t, nil)
+	// c stops accepting p2p connections
+	c.ListenP2P(t, nil).Close()
+
+	seed := a.Peer()
+	got := crawlFakes(map[string]*Peer{seed.ID: seed}, CrawlOptions{MaxDepth: 1, MaxPeers: 100})
+	assert.Len(t, got, 3)
+	_, port, _ := net.SplitHostPort(la.Addr().String())
+	assert.Equal(t, "127.0.0.1:"+port, got["aaaa"].P2PAddr)
+	assert.True(t, got["aaaa"].P2PReachable)
+	assert.Equal(t, lb.Addr().String(), got["bbbb"].P2PAddr)
+	assert.True(t, got["bbbb"].P2PReachable)
+	assert.Equal(t, "bbbb@"+lb.Addr().String(), got["bbbb"].P2PAddress())
+	assert.NotEmpty(t, got["cccc"].P2PAddr)
+	assert.False(t, got["cccc"].P2PReachable)
+}
+
+func TestCrawlP2POnlyPeers(t *testing.T) {
+	a := newFakeNode(t, "aaaa", "test-1", 10)
+	sentry := newFakeNode(t, "sentry", "test-1", 10)
+	down := newFakeNode(t, "down", "test-1", 10)
+	sentry.noRPC, down.noRPC = true, true
+	a.Connect(sentry, down)
+	ls := sentry.ListenP2P(t, nil)
+	down.ListenP2P(t, nil).Close()
+
+	seed := a.Peer()
+	got, contacted := RefreshPeers(context.Background(), NewScheduler(DefaultSchedulerOptions()), map[string]*Peer{seed.ID: seed}, CrawlOptions{MaxDepth: 1, MaxPeers: 100}, log.NewNopLogger())
+	// peers without rpc are recorded on their p2p address
+	assert.Len(t, got, 2)
+	assert.Equal(t, []string{"aaaa", "down", "sentry"}, contacted)
+	assert.Empty(t, got["sentry"].Address)
+	assert.Equal(t, ls.Addr().String(), got["sentry"].P2PAddr)
+	assert.True(t, got["sentry"].P2PReachable)
+	assert.True(t, got["sentry"].Reachable)
+	assert.False(t, got["sentry"].rpcUsable())
+
+	// they are exported, but asked nothing on rpc
+	s := NewPeerStore(nil, DefaultPeerStoreOptions())
+	s.Merge(got, contacted, time.Now())
+	peers := []Peer{}
+	for _, p := range s.Peers() {
+		peers = append(peers, *p)
+	}
+	assert.Equal(t, []string{"sentry@" + ls.Addr().String()}, PersistentPeerAddresses(peers, 10))
+	assert.Len(t, BestPeers(peers, 10), 1)
+	_, err := targetHeight(context.Background(), NewScheduler(DefaultSchedulerOptions()), map[string]*Peer{"sentry": got["sentry"]}, "test-1", HeightOptions{}, log.NewNopLogger())
+	assert.NotNil(t, err)
+
+	// the next crawl checks them on their p2p address again
+	got, _ = RefreshPeers(context.Background(), NewScheduler(DefaultSchedulerOptions()), s.Peers(), CrawlOptions{MaxPeers: 100}, log.NewNopLogger())
+	assert.True(t, got["sentry"].Reachable)
+}
+
+func TestContactP2P(t *testing.T) {
+	l := listenP2P(t, nil)
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+
+	// the peer reports another host, only its port is used
+	p := &Peer{ID: "aaaa", Address: "http://127.0.0.1:26657"}
+	p.contactP2P(context.Background(), "tcp://203.0.113.1:"+port)
+	assert.Equal(t, "127.0.0.1:"+port, p.P2PAddr)
+	assert.True(t, p.P2PReachable)
+
+	// the ip the introducer sees the peer from wins over the rpc host
+	p = &Peer{ID: "aaaa", Address: "https://rpc.example.com:443", remoteIP: "127.0.0.1"}
+	p.contactP2P(context.Background(), "tcp://0.0.0.0:"+port)
+	assert.Equal(t, "127.0.0.1:"+port, p.P2PAddr)
+	assert.True(t, p.P2PReachable)
+}
+
+func TestExportPeers(t *testing.T) {
+	registry := t.TempDir()
+	writeRegistryChain(t, registry, "test-1", "{}", []Peer{
+		{ID: "seed", Address: "http://10.0.0.1:26657", IsSeed: true, Reachable: true, P2PAddr: "10.0.0.1:26656", P2PReachable: true},
+		{ID: "down-seed", Address: "http://10.0.0.9:26657", IsSeed: true, P2PAddr: "10.0.0.9:26656"},
+		{ID: "a", Address: "https://a.example.com:443", Reachable: true, LastContactHeight: 99, P2PAddr: "a.example.com:26666", P2PReachable: true},
+		{ID: "b", Address: "http://10.0.0.2:26657", Reachable: true, LastContactHeight: 100, P2PAddr: "10.0.0.2:26656", P2PReachable: true},
+		{ID: "c", Address: "http://10.0.0.3:26657", Reachable: true, LastContactHeight: 100, P2PAddr: "10.0.0.3:26656"},
+		// registered before the p2p addresses were collected
+		{ID: "d", Address: "http://10.0.0.4:26657", Reachable: true, LastContactHeight: 98},
+	}, nil)
+
+	out, err := ExportPeers(registry, "test-1", ExportSeeds, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, "seed@10.0.0.1:26656", out)
+	out, err = ExportPeers(registry, "test-1", ExportPersistentPeers, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, "b@10.0.0.2:26656,a@a.example.com:26666,d@10.0.0.4:26656", out)
+	out, err = ExportPeers(registry, "test-1", ExportPersistentPeers, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, "b@10.0.0.2:26656", out)
+
+	_, err = ExportPeers(registry, "test-1", "addrbook", 10)
+	assert.NotNil(t, err)
+	_, err = ExportPeers(registry, "test-2", ExportSeeds, 10)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,173 @@
+package node
+
+import (
+	"sort"
+	"time"
+
+	"github.com/tendermint/tendermint/libs/log"
+)
+
+// PeerStoreOptions are the rules a PeerStore applies to the crawl results
+type PeerStoreOptions struct {
+	// MaxFailures is the number of consecutive failed contacts after which
+	// a peer is evicted, 0 never evicts peers
+	MaxFailures int
+	// Window is the number of contacts the success ratio of a peer is
+	// averaged over, older contacts weigh less and less
+	Window int
+}
+
+// DefaultPeerStoreOptions returns the peer store rules used when none are
+// configured
+func DefaultPeerStoreOptions() PeerStoreOptions {
+	return PeerStoreOptions{
+		MaxFailures: 5,
+		Window:      20,
+	}
+}
+
+// PeerStore is the set of peers of a chain across updates. The peers found
+// by a crawl are merged into the known ones instead of replacing them, so a
+// peer that is down for a run is kept until it fails MaxFailures times in a
+// row.
+type PeerStore struct {
+	opts  PeerStoreOptions
+	peers map[string]*Peer
+}
+
+// NewPeerStore returns a store of the peers
+func NewPeerStore(peers map[string]*Peer, opts PeerStoreOptions) *PeerStore {
+	s := &PeerStore{opts: opts, peers: make(map[string]*Peer, len(peers))}
+	for id, p := range peers {
+		s.peers[id] = p
+	}
+	return s
+}
+
+// LoadPeerStore loads the peers of a chain into a store
+func LoadPeerStore(basePath, chainID string, opts PeerStoreOptions, logger log.Logger) (s *PeerStore, err error) {
+	peers, err := LoadPeers(basePath, chainID, "", logger)
+	if err != nil {
+		return
+	}
+	return NewPeerStore(peers, opts), nil
+}
+
+// Peers returns a copy of the peers in the store, the crawl updates the
+// peers it is given in place and they are merged back with Merge
+func (s *PeerStore) Peers() map[string]*Peer {
+	peers := make(map[string]*Peer, len(s.peers))
+	for id, p := range s.peers {
+		p := *p
+		peers[id] = &p
+	}
+	return peers
+}
+
+// Len returns the number of peers in the store
+func (s *PeerStore) Len() int { return len(s.peers) }
+
+// Get returns a peer of the store
+func (s *PeerStore) Get(id string) (p *Peer, ok bool) {
+	p, ok = s.peers[id]
+	return
+}
+
+// Merge records the outcome of a crawl that started from the peers of the
+// store: the crawled peers are added with Add, the known peers the crawl
+// contacted that are missing from its results count as a failure. Known
+// peers the crawl did not get to, because of its limits or deadline, are
+// left as they are. The IDs of the peers that reached the maximum number of
+// consecutive failures are returned, sorted, and removed.
+func (s *PeerStore) Merge(crawled map[string]*Peer, contacted []string, now time.Time) (evicted []string) {
+	for _, c := range crawled {
+		s.Add(c, now)
+	}
+	for _, id := range contacted {
+		p, known := s.peers[id]
+		if _, ok := crawled[id]; ok || !known {
+			continue
+		}
+		p.Reachable, p.UpdatedAt = false, now
+		s.record(p, false)
+	}
+
+	for id, p := range s.peers {
+		if s.opts.MaxFailures > 0 && p.ConsecutiveFailures >= s.opts.MaxFailures {
+			evicted = append(evicted, id)
+			delete(s.peers, id)
+		}
+	}
+	sort.Strings(evicted)
+	return
+}
+
+// Add merges the outcome of a contact with a peer into the store. A
+// reachable peer counts as a success, a forked or impersonated one as a
+// failure. New peers are added, the known ones keep their first sighting,
+// seed flag and the peer that introduced them.
+func (s *PeerStore) Add(c *Peer, now time.Time) {
+	p, known := s.peers[c.ID]
+	if !known {
+		p = &Peer{ID: c.ID, IntroducedBy: c.IntroducedBy}
+		s.peers[c.ID] = p
+	}
+	if p.FirstSeen.IsZero() {
+		p.FirstSeen = now
+	}
+	p.IsSeed = p.IsSeed || c.IsSeed
+	if p.IntroducedBy == "" {
+		p.IntroducedBy = c.IntroducedBy
+	}
+	if c.Address != "" {
+		p.Address = c.Address
+	}
+	if c.P2PAddr != "" {
+		p.P2PAddr = c.P2PAddr
+	}
+	if c.Identity != "" {
+		p.Identity = c.Identity
+	}
+	p.Reachable, p.Forked = c.Reachable, c.Forked
+	p.P2PReachable = c.P2PReachable
+	if c.Reachable {
+		p.LastContactHeight, p.LastContactDate = c.LastContactHeight, c.LastContactDate
+		p.EarliestHeight, p.CatchingUp = c.EarliestHeight, c.CatchingUp
+	}
+	p.LastSeen, p.UpdatedAt = now, now
+	s.record(p, c.Reachable)
+}
+
+// record adds the outcome of a contact to the success ratio of a peer. The
+// ratio is the average of the outcomes until the window is full, then a
+// moving average over the window.
+func (s *PeerStore) record(p *Peer, ok bool) {
+	outcome := 0.0
+	if ok {
+		outcome = 1
+		p.ConsecutiveFailures = 0
+	} else {
+		p.ConsecutiveFailures++
+	}
+	if p.Contacts < s.opts.Window || s.opts.Window <= 0 {
+		p.Contacts++
+	}
+	p.SuccessRatio += (outcome - p.SuccessRatio) / float64(p.Contacts)
+}
+
+// Classify sets the classes of the reachable peers of the store
+func (s *PeerStore) Classify(opts ClassifyOptions) {
+	ClassifyPeers(s.peers, opts)
+}
+
+// Remove drops peers from the store
+func (s *PeerStore) Remove(ids ...string) {
+	for _, id := range ids {
+		delete(s.peers, id)
+	}
+}
+
+// Save writes the peers of the store to the peers.json of a chain
+func (s *PeerStore) Save(basePath, chainID string, logger log.Logger) error {
+	return SavePeers(basePath, chainID, s.peers, logger)
+}
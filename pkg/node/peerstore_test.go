@@ -0,0 +1,111 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tendermint/tendermint/libs/log"
+)
+
+func TestPeerStoreMerge(t *testing.T) {
+	t0 := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	s := NewPeerStore(map[string]*Peer{
+		"seed": {ID: "seed", Address: "http://seed:26657", IsSeed: true},
+	}, PeerStoreOptions{MaxFailures: 3, Window: 4})
+
+	// the crawl works on copies of the peers
+	crawled := s.Peers()
+	crawled["seed"].Reachable, crawled["seed"].LastContactHeight = true, 100
+	crawled["aaaa"] = &Peer{ID: "aaaa", Address: "http://a:26657", IntroducedBy: "seed", Reachable: true, LastContactHeight: 101}
+	seed, _ := s.Get("seed")
+	assert.False(t, seed.Reachable)
+	assert.Empty(t, s.Merge(crawled, []string{"aaaa", "seed"}, t0))
+	assert.Equal(t, 2, s.Len())
+	a, _ := s.Get("aaaa")
+	assert.Equal(t, t0, a.FirstSeen)
+	assert.Equal(t, 1.0, a.SuccessRatio)
+	assert.Equal(t, int64(101), a.LastContactHeight)
+
+	// contacted peers missing from a crawl are kept, down, with their last
+	// contact
+	t1 := t0.Add(time.Hour)
+	assert.Empty(t, s.Merge(map[string]*Peer{
+		"aaaa": {ID: "aaaa", Address: "http://a:26657", IntroducedBy: "bbbb", Reachable: true, LastContactHeight: 200},
+	}, []string{"aaaa", "seed"}, t1))
+	seed, _ = s.Get("seed")
+	assert.True(t, seed.IsSeed)
+	assert.False(t, seed.Reachable)
+	assert.Equal(t, int64(100), seed.LastContactHeight)
+	assert.Equal(t, t0, seed.LastSeen)
+	assert.Equal(t, 0.5, seed.SuccessRatio)
+	assert.Equal(t, 1, seed.ConsecutiveFailures)
+	a, _ = s.Get("aaaa")
+	assert.Equal(t, "seed", a.IntroducedBy)
+	assert.Equal(t, t0, a.FirstSeen)
+	assert.Equal(t, t1, a.LastSeen)
+
+	// forked peers fail too
+	assert.Empty(t, s.Merge(map[string]*Peer{
+		"aaaa": {ID: "aaaa", Reachable: true},
+		"seed": {ID: "seed", Forked: true},
+	}, []string{"aaaa", "seed"}, t1))
+	seed, _ = s.Get("seed")
+	assert.True(t, seed.Forked)
+	assert.Equal(t, 2, seed.ConsecutiveFailures)
+
+	// peers the crawl did not get to are left as they are
+	assert.Empty(t, s.Merge(map[string]*Peer{"aaaa": {ID: "aaaa", Reachable: true}}, []string{"aaaa"}, t1))
+	assert.Equal(t, 2, seed.ConsecutiveFailures)
+
+	// the ratio is averaged over the window
+	assert.Equal(t, []string{"seed"}, s.Merge(map[string]*Peer{"aaaa": {ID: "aaaa", Reachable: true}}, []string{"aaaa", "seed"}, t1))
+	assert.Equal(t, 1, s.Len())
+	s.Merge(nil, []string{"aaaa"}, t1)
+	a, _ = s.Get("aaaa")
+	assert.Equal(t, 4, a.Contacts)
+	assert.Equal(t, 0.75, a.SuccessRatio)
+	s.Merge(nil, []string{"aaaa"}, t1)
+	assert.Equal(t, 4, a.Contacts)
+	assert.InDelta(t, 0.5625, a.SuccessRatio, 1e-9)
+
+	// a success resets the failures
+	s.Merge(map[string]*Peer{"aaaa": {ID: "aaaa", Reachable: true}}, []string{"aaaa"}, t1)
+	assert.Equal(t, 0, a.ConsecutiveFailures)
+}
+
+func TestPeerStoreNoEviction(t *testing.T) {
+	s := NewPeerStore(map[string]*Peer{"aaaa": {ID: "aaaa"}}, PeerStoreOptions{})
+	for i := 0; i < 10; i++ {
+		assert.Empty(t, s.Merge(nil, []string{"aaaa"}, time.Now()))
+	}
+	a, _ := s.Get("aaaa")
+	assert.Equal(t, 10, a.ConsecutiveFailures)
+	assert.Equal(t, 10, a.Contacts)
+}
+
+func TestLoadPeerStore(t *testing.T) {
+	registry := t.TempDir()
+	writeRegistryChain(t, registry, "test-1", "{}", []Peer{
+		{ID: "aaaa", Address: "http://a:26657"},
+		{ID: "bbbb", Address: "http://b:26657"},
+	}, nil)
+	s, err := LoadPeerStore(registry, "test-1", DefaultPeerStoreOptions(), log.NewNopLogger())
+	assert.Nil(t, err)
+	a, _ := s.Get("aaaa")
+	assert.Equal(t, "http://a:26657", a.Address)
+	s.Remove("bbbb")
+	s.Add(&Peer{ID: "cccc", Reachable: true}, time.Now())
+	assert.Nil(t, s.Save(registry, "test-1", log.NewNopLogger()))
+
+	s, err = LoadPeerStore(registry, "test-1", DefaultPeerStoreOptions(), log.NewNopLogger())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, s.Len())
+	_, ok := s.Get("bbbb")
+	assert.False(t, ok)
+
+	// no peers registered
+	s, err = LoadPeerStore(registry, "test-2", DefaultPeerStoreOptions(), log.NewNopLogger())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, s.Len())
+}
@@ -0,0 +1,126 @@
+package node
+
+import (
+	"fmt"
+
+	"github.com/jackzampolin/cosmos-registrar/pkg/utils"
+	"github.com/tendermint/tendermint/libs/log"
+)
+
+// RetentionPolicy decides which light roots are kept in the history of a
+// chain. A root is kept if any of the rules keeps it, a zero policy keeps
+// every root.
+type RetentionPolicy struct {
+	// KeepLast is the number of most recent roots always kept
+	KeepLast int `json:"keep-last"`
+	// KeepDaily is the number of days for which the most recent root of the
+	// day is kept
+	KeepDaily int `json:"keep-daily"`
+	// KeepWeekly is the number of weeks for which the most recent root of the
+	// week is kept
+	KeepWeekly int `json:"keep-weekly"`
+}
+
+// DefaultRetentionPolicy keeps the last 48 roots, one root per day for a
+// month and one per week for a year
+func DefaultRetentionPolicy() RetentionPolicy {
+	return RetentionPolicy{
+		KeepLast:   48,
+		KeepDaily:  30,
+		KeepWeekly: 52,
+	}
+}
+
+// IsZero tells if the policy keeps every root
+func (p RetentionPolicy) IsZero() bool {
+	return p.KeepLast <= 0 && p.KeepDaily <= 0 && p.KeepWeekly <= 0
+}
+
+// String implements fmt.Stringer
+func (p RetentionPolicy) String() string {
+	if p.IsZero() {
+		return "keep all"
+	}
+	return fmt.Sprintf("keep last %d, daily %d, weekly %d", p.KeepLast, p.KeepDaily, p.KeepWeekly)
+}
+
+// LoadRetentionPolicy loads the retention policy of the light roots of a
+// chain, a chain without retention file uses the default policy
+func LoadRetentionPolicy(basePath, chainID string) (p RetentionPolicy, err error) {
+	repoRoot := repoDir{basePath, chainID}
+	p = DefaultRetentionPolicy()
+	if !utils.PathExists(repoRoot.retentionPath()) {
+		return
+	}
+	err = utils.FromJSON(repoRoot.retentionPath(), &p)
+	return
+}
+
+// SaveRetentionPolicy writes the retention policy of the light roots of a
+// chain
+func SaveRetentionPolicy(basePath, chainID string, p RetentionPolicy) error {
+	repoRoot := repoDir{basePath, chainID}
+	return utils.ToJSON(repoRoot.retentionPath(), p)
+}
+
+// Apply returns the roots of the history, ordered oldest first, that the
+// policy keeps, in their original order. Days and weeks are calendar days and
+// ISO weeks in UTC. Roots recorded without a time, before the time was part
+// of the light roots, cannot be bucketed and are always kept.
+func (p RetentionPolicy) Apply(lrh LightRootHistory) LightRootHistory {
+	if p.IsZero() {
+		return lrh
+	}
+	keep := make([]bool, len(lrh))
+	days, weeks := map[string]bool{}, map[string]bool{}
+	// walk from the most recent root
+	for i, n := len(lrh)-1, 0; i >= 0; i, n = i-1, n+1 {
+		if n < p.KeepLast || lrh[i].Time.IsZero() {
+			keep[i] = true
+		}
+		if lrh[i].Time.IsZero() {
+			continue
+		}
+		t := lrh[i].Time.UTC()
+		if day := t.Format("2006-01-02"); !days[day] && len(days) < p.KeepDaily {
+			days[day] = true
+			keep[i] = true
+		}
+		year, week := t.ISOWeek()
+		if w := fmt.Sprintf("%d-%02d", year, week); !weeks[w] && len(weeks) < p.KeepWeekly {
+			weeks[w] = true
+			keep[i] = true
+		}
+	}
+	kept := LightRootHistory{}
+	for i, lr := range lrh {
+		if keep[i] {
+			kept = append(kept, lr)
+		}
+	}
+	return kept
+}
+
+// PruneLightRoots applies the retention policy to the light root history of
+// a chain and returns the roots that were removed. If dryRun is true the
+// history is left untouched.
+func PruneLightRoots(basePath, chainID string, policy RetentionPolicy, dryRun bool, logger log.Logger) (removed LightRootHistory, err error) {
+	lrh, err := LoadLightRoots(basePath, chainID)
+	if err != nil {
+		return
+	}
+	kept := policy.Apply(lrh)
+	for i, j := 0, 0; i < len(lrh); i++ {
+		if j < len(kept) && lrh[i].sameBlock(kept[j]) {
+			j++
+			continue
+		}
+		removed = append(removed, lrh[i])
+	}
+	if len(removed) == 0 || dryRun {
+		return
+	}
+	logger.Debug("pruning light roots", "chainID", chainID, "removed", len(removed), "kept", len(kept))
+	err = writeLightRoots(basePath, chainID, kept)
+	return
+}
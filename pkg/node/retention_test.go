@@ -0,0 +1,120 @@
+package node
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tendermint/tendermint/libs/log"
+)
+
+// hourlyRoots returns a root every hour for the given number of days, ending
+// at end
+func hourlyRoots(days int, end time.Time) LightRootHistory {
+	lrh := LightRootHistory{}
+	start := end.Add(-time.Duration(days*24-1) * time.Hour)
+	for i := 0; i < days*24; i++ {
+		lrh = append(lrh, LightRoot{
+			TrustHeight: int64(i + 1),
+			TrustHash:   "AA",
+			Time:        start.Add(time.Duration(i) * time.Hour),
+		})
+	}
+	return lrh
+}
+
+func TestRetentionPolicyApply(t *testing.T) {
+	end := time.Date(2021, 6, 30, 23, 0, 0, 0, time.UTC)
+	lrh := hourlyRoots(60, end)
+
+	// zero policy keeps everything
+	assert.Equal(t, lrh, RetentionPolicy{}.Apply(lrh))
+
+	kept := RetentionPolicy{KeepLast: 5}.Apply(lrh)
+	assert.Equal(t, lrh[len(lrh)-5:], kept)
+
+	// the last root of each of the last 3 days
+	kept = RetentionPolicy{KeepDaily: 3}.Apply(lrh)
+	assert.Len(t, kept, 3)
+	for _, lr := range kept {
+		assert.Equal(t, 23, lr.Time.Hour())
+	}
+	assert.Equal(t, end, kept[2].Time)
+
+	// the last root of each of the last 4 ISO weeks, the first is the current
+	// week (ending on Wednesday 30 June)
+	kept = RetentionPolicy{KeepWeekly: 4}.Apply(lrh)
+	assert.Len(t, kept, 4)
+	assert.Equal(t, end, kept[3].Time)
+	assert.Equal(t, time.Sunday, kept[2].Time.Weekday())
+
+	// rules are combined and the original order is preserved
+	kept = RetentionPolicy{KeepLast: 24, KeepDaily: 7, KeepWeekly: 8}.Apply(lrh)
+	for i := 1; i < len(kept); i++ {
+		assert.True(t, kept[i-1].TrustHeight < kept[i].TrustHeight)
+	}
+	assert.Equal(t, 24+6+6, len(kept))
+
+}
+
+func TestRetentionPolicyLegacyRoots(t *testing.T) {
+	// a history written before the roots had a time, followed by dated roots
+	lrh := LightRootHistory{{TrustHeight: 1, TrustHash: "AA"}, {TrustHeight: 2, TrustHash: "BB"}, {TrustHeight: 3, TrustHash: "CC"}}
+	dated := hourlyRoots(3, time.Date(2021, 6, 30, 23, 0, 0, 0, time.UTC))
+	for i := range dated {
+		dated[i].TrustHeight += 3
+	}
+	lrh = append(lrh, dated...)
+
+	// undated roots cannot be bucketed and are kept
+	kept := RetentionPolicy{KeepLast: 1, KeepDaily: 1}.Apply(lrh)
+	assert.Equal(t, lrh[:3], kept[:3])
+	assert.Equal(t, LightRootHistory{lrh[len(lrh)-1]}, kept[3:])
+}
+
+func TestLoadRetentionPolicy(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.MkdirAll(path.Join(dir, "test-1", "light-roots"), 0700))
+
+	// chains without retention file use the default policy
+	p, err := LoadRetentionPolicy(dir, "test-1")
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultRetentionPolicy(), p)
+
+	want := RetentionPolicy{KeepLast: 10, KeepWeekly: 4}
+	assert.Nil(t, SaveRetentionPolicy(dir, "test-1", want))
+	p, err = LoadRetentionPolicy(dir, "test-1")
+	assert.Nil(t, err)
+	assert.Equal(t, want, p)
+}
+
+func TestPruneLightRoots(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.MkdirAll(path.Join(dir, "test-1", "light-roots"), 0700))
+	lrh := hourlyRoots(3, time.Date(2021, 6, 30, 23, 0, 0, 0, time.UTC))
+	assert.Nil(t, writeLightRoots(dir, "test-1", lrh))
+
+	policy := RetentionPolicy{KeepLast: 2, KeepDaily: 3}
+	removed, err := PruneLightRoots(dir, "test-1", policy, true, log.NewNopLogger())
+	assert.Nil(t, err)
+	assert.Len(t, removed, 72-4)
+	got, err := LoadLightRoots(dir, "test-1")
+	assert.Nil(t, err)
+	assert.Len(t, got, 72)
+
+	removed, err = PruneLightRoots(dir, "test-1", policy, false, log.NewNopLogger())
+	assert.Nil(t, err)
+	assert.Len(t, removed, 72-4)
+	got, err = LoadLightRoots(dir, "test-1")
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{24, 48, 71, 72}, []int64{got[0].TrustHeight, got[1].TrustHeight, got[2].TrustHeight, got[3].TrustHeight})
+
+	// saving applies the policy
+	next := LightRoot{TrustHeight: 73, TrustHash: "AA", Time: time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC)}
+	assert.Nil(t, SaveLightRoots(dir, "test-1", &next, policy, log.NewNopLogger()))
+	got, err = LoadLightRoots(dir, "test-1")
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{48, 72, 73}, []int64{got[0].TrustHeight, got[1].TrustHeight, got[2].TrustHeight})
+}
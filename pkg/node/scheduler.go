@@ -0,0 +1,89 @@
+package node
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SchedulerOptions configures how requests to peers are fanned out
+type SchedulerOptions struct {
+	// Concurrency is the maximum number of requests in flight at any time
+	Concurrency int
+	// RequestTimeout bounds a single request to a peer
+	RequestTimeout time.Duration
+	// Deadline bounds a whole run, 0 means no deadline
+	Deadline time.Duration
+}
+
+// DefaultSchedulerOptions returns the limits used when none are configured
+func DefaultSchedulerOptions() SchedulerOptions {
+	return SchedulerOptions{
+		Concurrency:    32,
+		RequestTimeout: 2 * time.Second,
+		Deadline:       10 * time.Minute,
+	}
+}
+
+// Scheduler caps the number of requests made to peers concurrently. A single
+// Scheduler is meant to be shared by everything that talks to the network
+// during a run, so that the cap applies across chains.
+type Scheduler struct {
+	opts  SchedulerOptions
+	slots chan struct{}
+}
+
+// NewScheduler returns a scheduler with the given limits, zero values are
+// replaced with the defaults
+func NewScheduler(opts SchedulerOptions) *Scheduler {
+	def := DefaultSchedulerOptions()
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = def.Concurrency
+	}
+	if opts.RequestTimeout <= 0 {
+		opts.RequestTimeout = def.RequestTimeout
+	}
+	return &Scheduler{
+		opts:  opts,
+		slots: make(chan struct{}, opts.Concurrency),
+	}
+}
+
+// WithDeadline returns a context that is canceled when the run deadline
+// expires
+func (s *Scheduler) WithDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.opts.Deadline <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.opts.Deadline)
+}
+
+// Do waits for a free slot and calls fn with a context bounded by the request
+// timeout. If ctx is done before a slot frees up fn is not called and the
+// context error is returned.
+func (s *Scheduler) Do(ctx context.Context, fn func(ctx context.Context)) error {
+	select {
+	case s.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-s.slots }()
+	// the context may be done even if a slot was free
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.opts.RequestTimeout)
+	defer cancel()
+	fn(ctx)
+	return nil
+}
+
+// Go runs Do in a new goroutine tracked by wg
+func (s *Scheduler) Go(ctx context.Context, wg *sync.WaitGroup, fn func(ctx context.Context)) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.Do(ctx, fn)
+	}()
+}
@@ -0,0 +1,65 @@
+package node
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedulerConcurrency(t *testing.T) {
+	s := NewScheduler(SchedulerOptions{Concurrency: 3, RequestTimeout: time.Second})
+	var running, peak int32
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		s.Go(context.Background(), &wg, func(ctx context.Context) {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+		})
+	}
+	wg.Wait()
+	assert.Equal(t, int32(3), peak)
+}
+
+func TestSchedulerRequestTimeout(t *testing.T) {
+	s := NewScheduler(SchedulerOptions{Concurrency: 1, RequestTimeout: 10 * time.Millisecond})
+	var reqErr error
+	err := s.Do(context.Background(), func(ctx context.Context) {
+		<-ctx.Done()
+		reqErr = ctx.Err()
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, context.DeadlineExceeded, reqErr)
+}
+
+func TestSchedulerCanceled(t *testing.T) {
+	s := NewScheduler(SchedulerOptions{Concurrency: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	called := false
+	err := s.Do(ctx, func(ctx context.Context) { called = true })
+	assert.Equal(t, context.Canceled, err)
+	assert.False(t, called)
+
+	// a run deadline cancels requests waiting for a slot
+	s = NewScheduler(SchedulerOptions{Concurrency: 1, Deadline: 20 * time.Millisecond})
+	ctx, cancel = s.WithDeadline(context.Background())
+	defer cancel()
+	release := make(chan struct{})
+	go s.Do(context.Background(), func(ctx context.Context) { <-release })
+	time.Sleep(5 * time.Millisecond)
+	err = s.Do(ctx, func(ctx context.Context) { called = true })
+	close(release)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.False(t, called)
+}
@@ -0,0 +1,123 @@
+package node
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackzampolin/cosmos-registrar/pkg/tmconfig"
+	"github.com/jackzampolin/cosmos-registrar/pkg/utils"
+	"github.com/tendermint/tendermint/libs/log"
+)
+
+// DefaultStateSyncServers is the number of rpc servers configured for the
+// state sync light client, tendermint requires at least two
+const DefaultStateSyncServers = 3
+
+// StateSync is the [statesync] section of the configuration of a tendermint
+// node
+type StateSync struct {
+	Enable      bool
+	RPCServers  []string
+	TrustHeight int64
+	TrustHash   string
+	TrustPeriod time.Duration
+}
+
+// NewStateSync builds the state sync configuration of a chain from the
+// registry: the latest light root is the root of trust, the rpc servers are
+// the best reachable peers and the trust period is derived from the
+// unbonding time in the genesis.
+func NewStateSync(basePath, chainID string, servers int, logger log.Logger) (ss *StateSync, err error) {
+	lrh, err := LoadLightRoots(basePath, chainID)
+	if err != nil {
+		return nil, fmt.Errorf("loading light roots: %s", err)
+	}
+	if len(lrh) == 0 {
+		return nil, fmt.Errorf("no light roots registered for chain %s", chainID)
+	}
+	lr := lrh[len(lrh)-1]
+
+	peers := []Peer{}
+	if err = utils.FromJSON(repoDir{basePath, chainID}.peersPath(), &peers); err != nil {
+		return nil, fmt.Errorf("loading peers: %s", err)
+	}
+	best := BestPeers(peers, servers)
+	if len(best) < 2 {
+		return nil, fmt.Errorf("state sync needs at least 2 rpc servers, %d reachable peers registered for chain %s", len(best), chainID)
+	}
+
+	g, err := OpenGenesis(basePath, chainID)
+	if err != nil {
+		return nil, fmt.Errorf("opening genesis: %s", err)
+	}
+	defer g.Close()
+	unbonding, err := GenesisUnbondingTime(g)
+	if err != nil {
+		return nil, err
+	}
+
+	ss = &StateSync{
+		Enable:      true,
+		TrustHeight: lr.TrustHeight,
+		TrustHash:   lr.TrustHash,
+		TrustPeriod: TrustPeriod(unbonding),
+	}
+	for _, p := range best {
+		ss.RPCServers = append(ss.RPCServers, p.Address)
+	}
+	if !lr.Time.IsZero() && time.Since(lr.Time) > ss.TrustPeriod {
+		return nil, fmt.Errorf("the latest light root of chain %s (height %d, %s) is older than the trust period of %s",
+			chainID, lr.TrustHeight, lr.Time.Format(time.RFC3339), ss.TrustPeriod)
+	}
+	logger.Debug("state sync configuration", "chainID", chainID, "trust-height", ss.TrustHeight, "unbonding-time", unbonding)
+	return
+}
+
+// TrustPeriod is the trust period to use for a chain with the given
+// unbonding time, two thirds of it as recommended by tendermint
+func TrustPeriod(unbonding time.Duration) time.Duration {
+	return unbonding / 3 * 2
+}
+
+// BestPeers returns up to n reachable peers with an rpc address that are
+// neither syncing nor lagging, the ones that reported the highest block most
+// recently first
+func BestPeers(peers []Peer, n int) (best []Peer) {
+	for _, p := range peers {
+		if p.Reachable && p.Address != "" && !p.HasClass(PeerSyncing) && !p.HasClass(PeerLagging) {
+			best = append(best, p)
+		}
+	}
+	sort.SliceStable(best, func(i, j int) bool {
+		a, b := best[i], best[j]
+		if a.LastContactHeight != b.LastContactHeight {
+			return a.LastContactHeight > b.LastContactHeight
+		}
+		if !a.LastContactDate.Equal(b.LastContactDate) {
+			return a.LastContactDate.After(b.LastContactDate)
+		}
+		return a.ID < b.ID
+	})
+	if len(best) > n {
+		best = best[:n]
+	}
+	return
+}
+
+// Values returns the keys of the [statesync] section
+func (ss StateSync) Values() []tmconfig.Value {
+	return []tmconfig.Value{
+		tmconfig.Bool("enable", ss.Enable),
+		tmconfig.String("rpc_servers", strings.Join(ss.RPCServers, ",")),
+		tmconfig.Int("trust_height", ss.TrustHeight),
+		tmconfig.String("trust_hash", ss.TrustHash),
+		tmconfig.String("trust_period", ss.TrustPeriod.String()),
+	}
+}
+
+// String renders the [statesync] section
+func (ss StateSync) String() string {
+	return tmconfig.Render("statesync", ss.Values())
+}
@@ -0,0 +1,115 @@
+package node
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackzampolin/cosmos-registrar/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/tendermint/tendermint/libs/log"
+)
+
+// writeRegistryChain writes the registry files of a chain in dir
+func writeRegistryChain(t *testing.T, dir, chainID, genesis string, peers []Peer, lrh LightRootHistory) {
+	repoRoot := repoDir{dir, chainID}
+	assert.Nil(t, os.MkdirAll(repoRoot.lrpath(), 0700))
+	_, err := writeGenesisParts(dir, chainID, strings.NewReader(genesis), DefaultGenesisPartSize, log.NewNopLogger())
+	assert.Nil(t, err)
+	sum := fmt.Sprintf("%x", sha256.Sum256([]byte(genesis)))
+	assert.Nil(t, os.WriteFile(repoRoot.genesisSumPath(), []byte(sum), 0644))
+	assert.Nil(t, utils.ToJSON(repoRoot.peersPath(), peers))
+	assert.Nil(t, writeLightRoots(dir, chainID, lrh))
+}
+
+func TestGenesisUnbondingTime(t *testing.T) {
+	tests := []struct {
+		name    string
+		genesis string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"duration", `{"chain_id":"test-1","app_state":{"bank":{"balances":[{"a":[1,2,{"b":3}]}]},"staking":{"params":{"max_validators":100,"unbonding_time":"1814400s"}}}}`, 21 * 24 * time.Hour, false},
+		{"nanoseconds", `{"app_state":{"staking":{"params":{"unbonding_time":"1814400000000000"}}}}`, 21 * 24 * time.Hour, false},
+		{"no staking module", `{"app_state":{"bank":{}}}`, 0, true},
+		{"invalid", `{"app_state":{"staking":{"params":{"unbonding_time":"three weeks"}}}}`, 0, true},
+		{"not an object", `{"app_state":[]}`, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GenesisUnbondingTime(strings.NewReader(tt.genesis))
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestBestPeers(t *testing.T) {
+	now := time.Now()
+	peers := []Peer{
+		{ID: "a", Address: "http://a:26657", Reachable: true, LastContactHeight: 100, LastContactDate: now},
+		{ID: "b", Address: "http://b:26657", Reachable: false, LastContactHeight: 200, LastContactDate: now},
+		{ID: "c", Address: "http://c:26657", Reachable: true, LastContactHeight: 150, LastContactDate: now},
+		{ID: "d", Address: "http://d:26657", Reachable: true, LastContactHeight: 100, LastContactDate: now.Add(time.Minute)},
+		{ID: "e", Reachable: true, LastContactHeight: 300, LastContactDate: now},
+		{ID: "f", Address: "http://f:26657", Reachable: true, LastContactHeight: 160, Classes: []string{PeerPruned, PeerSyncing}},
+		{ID: "g", Address: "http://g:26657", Reachable: true, LastContactHeight: 160, Classes: []string{PeerArchive, PeerLagging}},
+	}
+	ids := func(ps []Peer) (ids []string) {
+		for _, p := range ps {
+			ids = append(ids, p.ID)
+		}
+		return
+	}
+	assert.Equal(t, []string{"c", "d", "a"}, ids(BestPeers(peers, 5)))
+	assert.Equal(t, []string{"c", "d"}, ids(BestPeers(peers, 2)))
+	assert.Empty(t, BestPeers(nil, 2))
+}
+
+func TestNewStateSync(t *testing.T) {
+	dir := t.TempDir()
+	genesis := `{"chain_id":"test-1","app_state":{"staking":{"params":{"unbonding_time":"1814400s"}}}}`
+	peers := []Peer{
+		{ID: "a", Address: "http://a:26657", Reachable: true, LastContactHeight: 100},
+		{ID: "b", Address: "http://b:26657", Reachable: true, LastContactHeight: 99},
+	}
+	lrh := LightRootHistory{
+		{TrustHeight: 10, TrustHash: "AA", Time: time.Now().Add(-time.Hour)},
+		{TrustHeight: 20, TrustHash: "BB", Time: time.Now()},
+	}
+	writeRegistryChain(t, dir, "test-1", genesis, peers, lrh)
+
+	ss, err := NewStateSync(dir, "test-1", 3, log.NewNopLogger())
+	assert.Nil(t, err)
+	assert.Equal(t, "[statesync]\n"+
+		"enable = true\n"+
+		"rpc_servers = \"http://a:26657,http://b:26657\"\n"+
+		"trust_height = 20\n"+
+		"trust_hash = \"BB\"\n"+
+		"trust_period = \"336h0m0s\"\n", ss.String())
+
+	// a single reachable peer is not enough
+	writeRegistryChain(t, dir, "test-2", genesis, peers[:1], lrh)
+	_, err = NewStateSync(dir, "test-2", 3, log.NewNopLogger())
+	assert.NotNil(t, err)
+
+	// the latest root is too old to be trusted
+	old := LightRootHistory{{TrustHeight: 10, TrustHash: "AA", Time: time.Now().Add(-15 * 24 * time.Hour)}}
+	writeRegistryChain(t, dir, "test-3", genesis, peers, old)
+	_, err = NewStateSync(dir, "test-3", 3, log.NewNopLogger())
+	assert.NotNil(t, err)
+
+	// no registry data
+	_, err = NewStateSync(dir, "test-4", 3, log.NewNopLogger())
+	assert.NotNil(t, err)
+	_, err = NewStateSync(path.Join(dir, "missing"), "test-1", 3, log.NewNopLogger())
+	assert.NotNil(t, err)
+}
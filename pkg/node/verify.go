@@ -0,0 +1,210 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tendermint/tendermint/libs/log"
+	"github.com/tendermint/tendermint/light"
+	"github.com/tendermint/tendermint/types"
+)
+
+const (
+	// the pivot used when bisecting, the same as tendermint's light client
+	verifySkippingNumerator   = 9
+	verifySkippingDenominator = 16
+	// validators per page when fetching validator sets
+	validatorsPerPage = 100
+	// bounds the number of validator pages a peer can make us fetch
+	maxValidatorPages = 100
+)
+
+// ErrTrustExpired is returned when the trusted light root is older than the
+// trusting period, so the new one can't be verified from it
+var ErrTrustExpired = errors.New("trusted light root expired")
+
+// LightRootOptions configures how new light roots are accepted
+type LightRootOptions struct {
+	// Agreement is the policy the peers must satisfy to accept a root
+	Agreement AgreementPolicy
+	// TrustingPeriod is how long a light root can be used to verify the next
+	// one, it should be shorter than the chain unbonding period
+	TrustingPeriod time.Duration
+	// Reanchor accepts the new light root on the agreement of the peers
+	// alone when the trusted one is older than the trusting period
+	Reanchor bool
+	// MaxClockDrift is how far in the future a header time can be
+	MaxClockDrift time.Duration
+	// Checkpoints are the pinned blocks of the chain, peers disagreeing with
+	// them are flagged as forked and ignored
+	Checkpoints Checkpoints
+	// Height is how the height of the new root is chosen
+	Height HeightOptions
+}
+
+// HeightOptions configures how the height of a new light root is chosen
+// from the latest heights the peers report
+type HeightOptions struct {
+	// Samples is the maximum number of peers, picked at random, asked for
+	// their latest height, 0 asks all of them
+	Samples int
+	// SafetyMargin is the number of blocks the new root is behind the median
+	// latest height, so that every peer has it
+	SafetyMargin int64
+	// MaxDeviation is the number of blocks a peer height can be away from
+	// the median before it is ignored, 0 keeps all of them
+	MaxDeviation int64
+}
+
+// DefaultLightRootOptions returns the options used when none are configured
+func DefaultLightRootOptions() LightRootOptions {
+	return LightRootOptions{
+		Agreement:      DefaultAgreementPolicy(),
+		TrustingPeriod: 14 * 24 * time.Hour,
+		MaxClockDrift:  10 * time.Second,
+		Height: HeightOptions{
+			Samples:      7,
+			SafetyMargin: 2,
+			MaxDeviation: 100,
+		},
+	}
+}
+
+// lightBlockSource fetches light blocks from a list of peers, moving to the
+// next peer when one fails or serves a block with an unexpected hash
+type lightBlockSource struct {
+	chainID string
+	sched   *Scheduler
+	peers   []*Peer
+	logger  log.Logger
+}
+
+// LightBlock returns the light block at height h. If hash is not empty only a
+// block with that hash is accepted.
+func (src *lightBlockSource) LightBlock(ctx context.Context, h int64, hash string) (lb *types.LightBlock, err error) {
+	err = fmt.Errorf("no peers to fetch the light block from")
+	for _, p := range src.peers {
+		if e := src.sched.Do(ctx, func(ctx context.Context) {
+			lb, err = fetchLightBlock(ctx, p.Address, src.chainID, h)
+		}); e != nil {
+			return nil, e
+		}
+		if err != nil {
+			src.logger.Debug("peer could not provide the light block", "peer", p.Address, "height", h, "error", err)
+			continue
+		}
+		if hash != "" && !strings.EqualFold(lb.Hash().String(), hash) {
+			err = fmt.Errorf("peer %s has hash %s at height %d, expected %s", p.ID, lb.Hash(), h, hash)
+			src.logger.Debug("peer served an unexpected light block", "peer", p.Address, "height", h, "error", err)
+			continue
+		}
+		return lb, nil
+	}
+	return nil, fmt.Errorf("fetching light block at height %d: %s", h, err)
+}
+
+// fetchLightBlock gets the signed header and the validator set at height h
+// from a node
+func fetchLightBlock(ctx context.Context, rpcAddress, chainID string, h int64) (*types.LightBlock, error) {
+	client, err := Client(rpcAddress)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := client.Commit(ctx, &h)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		vals    []*types.Validator
+		perPage = validatorsPerPage
+		total   = -1
+	)
+	for page := 1; len(vals) != total; page++ {
+		if page > maxValidatorPages {
+			return nil, fmt.Errorf("validator set at height %d has more than %d pages", h, maxValidatorPages)
+		}
+		res, err := client.Validators(ctx, &h, &page, &perPage)
+		if err != nil {
+			return nil, err
+		}
+		if len(res.Validators) == 0 || res.Total <= 0 {
+			return nil, fmt.Errorf("empty validator set at height %d", h)
+		}
+		total = res.Total
+		vals = append(vals, res.Validators...)
+	}
+	vs, err := types.ValidatorSetFromExistingValidators(vals)
+	if err != nil {
+		return nil, err
+	}
+	lb := &types.LightBlock{SignedHeader: &commit.SignedHeader, ValidatorSet: vs}
+	if err = lb.ValidateBasic(chainID); err != nil {
+		return nil, err
+	}
+	return lb, nil
+}
+
+// verifyLightRoot verifies the light root lr starting from the trusted light
+// root, using skipping verification and bisecting when the validator set
+// changed too much between the two heights
+func verifyLightRoot(ctx context.Context, src *lightBlockSource, trusted, lr *LightRoot, opts LightRootOptions, logger log.Logger) error {
+	switch {
+	case lr.TrustHeight < trusted.TrustHeight:
+		return fmt.Errorf("light root height %d is lower than the trusted height %d", lr.TrustHeight, trusted.TrustHeight)
+	case lr.TrustHeight == trusted.TrustHeight:
+		if !strings.EqualFold(lr.TrustHash, trusted.TrustHash) {
+			return fmt.Errorf("light root hash %s at height %d differs from the trusted hash %s", lr.TrustHash, lr.TrustHeight, trusted.TrustHash)
+		}
+		return nil
+	}
+
+	trustedBlock, err := src.LightBlock(ctx, trusted.TrustHeight, trusted.TrustHash)
+	if err != nil {
+		return fmt.Errorf("trusted light root: %s", err)
+	}
+	target, err := src.LightBlock(ctx, lr.TrustHeight, lr.TrustHash)
+	if err != nil {
+		return fmt.Errorf("new light root: %s", err)
+	}
+	return verifySkipping(ctx, src, trustedBlock, target, opts, time.Now(), logger)
+}
+
+func verifySkipping(ctx context.Context, src *lightBlockSource, trusted, target *types.LightBlock, opts LightRootOptions, now time.Time, logger log.Logger) error {
+	var (
+		cache    = []*types.LightBlock{target}
+		depth    = 0
+		verified = trusted
+	)
+	for {
+		logger.Debug("verifying light block", "trusted", verified.Height, "height", cache[depth].Height)
+		err := light.Verify(verified.SignedHeader, verified.ValidatorSet, cache[depth].SignedHeader, cache[depth].ValidatorSet,
+			opts.TrustingPeriod, now, opts.MaxClockDrift, light.DefaultTrustLevel)
+		switch err.(type) {
+		case nil:
+			if depth == 0 {
+				return nil
+			}
+			// the pivot is verified, move the trusted block forward
+			verified = cache[depth]
+			cache = cache[:depth]
+			depth = 0
+		case light.ErrNewValSetCantBeTrusted:
+			if depth == len(cache)-1 {
+				pivot := verified.Height + (cache[depth].Height-verified.Height)*verifySkippingNumerator/verifySkippingDenominator
+				lb, err := src.LightBlock(ctx, pivot, "")
+				if err != nil {
+					return fmt.Errorf("verifying height %d from %d: %s", target.Height, verified.Height, err)
+				}
+				cache = append(cache, lb)
+			}
+			depth++
+		case light.ErrOldHeaderExpired:
+			return fmt.Errorf("%w: height %d: %s", ErrTrustExpired, verified.Height, err)
+		default:
+			return fmt.Errorf("verifying height %d from %d: %s", cache[depth].Height, verified.Height, err)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tendermint/tendermint/libs/log"
+	"github.com/tendermint/tendermint/types"
+)
+
+// servePeers starts n fake nodes serving the chain and returns their records
+func servePeers(t *testing.T, c *fakeChain, ids ...string) map[string]*Peer {
+	peers := map[string]*Peer{}
+	for _, id := range ids {
+		n := newFakeNode(t, id, c.chainID, 0)
+		n.Serve(c)
+		peers[id] = n.Peer()
+	}
+	return peers
+}
+
+func TestUpdateLightRootsVerified(t *testing.T) {
+	valsA, valsB := newFakeValSet(4), newFakeValSet(4)
+	tests := []struct {
+		name   string
+		valsAt func(h int64) fakeValSet
+	}{
+		{"same validators", func(h int64) fakeValSet { return valsA }},
+		// the validator set changes completely at height 11, so the light
+		// client has to bisect to verify the latest height from height 1
+		{"validator set change", func(h int64) fakeValSet {
+			if h <= 10 {
+				return valsA
+			}
+			return valsB
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newFakeChain(t, "test-1", 20, tt.valsAt)
+			peers := servePeers(t, c, "aaaa", "bbbb", "cccc")
+			lr, dissenters, err := UpdateLightRoots(context.Background(), NewScheduler(DefaultSchedulerOptions()),
+				"test-1", peers, c.LightRoot(1), DefaultLightRootOptions(), log.NewNopLogger())
+			assert.Nil(t, err)
+			assert.Empty(t, dissenters)
+			// the root is the safety margin behind the latest height
+			want := c.LightRoot(20 - DefaultLightRootOptions().Height.SafetyMargin)
+			want.Peers = []string{"aaaa", "bbbb", "cccc"}
+			assert.Equal(t, want, lr)
+		})
+	}
+}
+
+func TestUpdateLightRootsVerificationFailures(t *testing.T) {
+	valsA := newFakeValSet(4)
+	c := newFakeChain(t, "test-1", 20, func(h int64) fakeValSet { return valsA })
+	// a chain sharing the first 10 blocks, then signed by validators unrelated
+	// to the trusted ones
+	other := newFakeChain(t, "test-1", 20, func(h int64) fakeValSet { return newFakeValSet(4) })
+	fork := &fakeChain{chainID: "test-1", blocks: map[int64]*types.LightBlock{}}
+	for h := int64(1); h <= 20; h++ {
+		fork.blocks[h] = c.blocks[h]
+		if h > 10 {
+			fork.blocks[h] = other.blocks[h]
+		}
+	}
+	expired := DefaultLightRootOptions()
+	expired.TrustingPeriod = time.Second
+
+	tests := []struct {
+		name    string
+		served  *fakeChain
+		trusted *LightRoot
+		opts    LightRootOptions
+	}{
+		{"fork", fork, c.LightRoot(1), DefaultLightRootOptions()},
+		{"unknown trusted root", c, other.LightRoot(1), DefaultLightRootOptions()},
+		{"trusting period expired", c, c.LightRoot(1), expired},
+		{"trusted root ahead", c, &LightRoot{TrustHeight: 30, TrustHash: "00"}, DefaultLightRootOptions()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			peers := servePeers(t, tt.served, "aaaa", "bbbb", "cccc")
+			_, _, err := UpdateLightRoots(context.Background(), NewScheduler(DefaultSchedulerOptions()),
+				"test-1", peers, tt.trusted, tt.opts, log.NewNopLogger())
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestUpdateLightRootsNotTrusted(t *testing.T) {
+	valsA := newFakeValSet(4)
+	c := newFakeChain(t, "test-1", 5, func(h int64) fakeValSet { return valsA })
+	peers := servePeers(t, c, "aaaa", "bbbb")
+	lr, _, err := UpdateLightRoots(context.Background(), NewScheduler(DefaultSchedulerOptions()),
+		"test-1", peers, nil, DefaultLightRootOptions(), log.NewNopLogger())
+	assert.Nil(t, err)
+	assert.True(t, c.LightRoot(5-DefaultLightRootOptions().Height.SafetyMargin).sameBlock(*lr))
+}
+
+func TestUpdateLightRootsExcludedPeers(t *testing.T) {
+	vals := newFakeValSet(4)
+	c := newFakeChain(t, "test-1", 20, func(h int64) fakeValSet { return vals })
+	other := newFakeChain(t, "test-1", 20, func(h int64) fakeValSet { return vals })
+	peers := servePeers(t, c, "aaaa", "bbbb")
+	// peers reporting another root that must not be asked
+	for id, p := range servePeers(t, other, "impersonated", "down") {
+		peers[id] = p
+	}
+	peers["impersonated"].Identity = IdentityImpersonated
+	peers["down"].Reachable = false
+
+	lr, dissenters, err := UpdateLightRoots(context.Background(), NewScheduler(DefaultSchedulerOptions()),
+		"test-1", peers, c.LightRoot(1), DefaultLightRootOptions(), log.NewNopLogger())
+	assert.Nil(t, err)
+	assert.Empty(t, dissenters)
+	assert.Equal(t, []string{"aaaa", "bbbb"}, lr.Peers)
+}
+
+func TestUpdateLightRootsReanchor(t *testing.T) {
+	vals := newFakeValSet(4)
+	c := newFakeChain(t, "test-1", 20, func(h int64) fakeValSet { return vals })
+	peers := servePeers(t, c, "aaaa", "bbbb", "cccc")
+	expired := DefaultLightRootOptions()
+	expired.TrustingPeriod = time.Second
+
+	_, _, err := UpdateLightRoots(context.Background(), NewScheduler(DefaultSchedulerOptions()),
+		"test-1", peers, c.LightRoot(1), expired, log.NewNopLogger())
+	assert.True(t, errors.Is(err, ErrTrustExpired))
+
+	// the root agreed on by the peers replaces the expired one
+	expired.Reanchor = true
+	lr, dissenters, err := UpdateLightRoots(context.Background(), NewScheduler(DefaultSchedulerOptions()),
+		"test-1", peers, c.LightRoot(1), expired, log.NewNopLogger())
+	assert.Nil(t, err)
+	assert.Empty(t, dissenters)
+	assert.True(t, c.LightRoot(20-expired.Height.SafetyMargin).sameBlock(*lr))
+
+	// other verification failures are not skipped
+	opts := DefaultLightRootOptions()
+	opts.Reanchor = true
+	_, _, err = UpdateLightRoots(context.Background(), NewScheduler(DefaultSchedulerOptions()),
+		"test-1", peers, &LightRoot{TrustHeight: 30, TrustHash: "00"}, opts, log.NewNopLogger())
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,152 @@
+// Package tmconfig edits the TOML configuration file of a tendermint node.
+//
+// The file is patched line by line so that the comments and the layout of
+// the configuration generated by tendermint are preserved.
+package tmconfig
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	sectionRe = regexp.MustCompile(`^\s*\[([^\[\]]+)\]\s*(#.*)?$`)
+	keyRe     = regexp.MustCompile(`^\s*([A-Za-z0-9_\-]+)\s*=`)
+)
+
+// Value is a key of a section together with its TOML encoded value
+type Value struct {
+	Key   string
+	Value string
+}
+
+// String returns a string value
+func String(key, value string) Value {
+	return Value{key, strconv.Quote(value)}
+}
+
+// Int returns an integer value
+func Int(key string, value int64) Value {
+	return Value{key, strconv.FormatInt(value, 10)}
+}
+
+// Bool returns a boolean value
+func Bool(key string, value bool) Value {
+	return Value{key, strconv.FormatBool(value)}
+}
+
+// Render returns the values as a TOML section
+func Render(section string, values []Value) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s]\n", section)
+	for _, v := range values {
+		fmt.Fprintf(&b, "%s = %s\n", v.Key, v.Value)
+	}
+	return b.String()
+}
+
+// Patch copies the configuration from r to w setting the values in the
+// section. Existing keys are replaced in place, missing keys are added at the
+// end of the section and the section is appended to the file if it does not
+// exist.
+func Patch(r io.Reader, w io.Writer, section string, values []Value) (err error) {
+	var (
+		lines   []string
+		current string
+		found   bool
+		set     = map[string]bool{}
+	)
+	// missing appends the values that were not found in the section
+	missing := func() {
+		for _, v := range values {
+			if !set[v.Key] {
+				lines = append(lines, fmt.Sprintf("%s = %s", v.Key, v.Value))
+				set[v.Key] = true
+			}
+		}
+	}
+
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	for s.Scan() {
+		line := s.Text()
+		if m := sectionRe.FindStringSubmatch(line); m != nil {
+			if current == section {
+				// add the keys after the last one of the section, before the
+				// blank lines and comments introducing the next section
+				at := len(lines)
+				for at > 0 && isBlankOrComment(lines[at-1]) {
+					at--
+				}
+				tail := append([]string{}, lines[at:]...)
+				lines = lines[:at]
+				missing()
+				lines = append(lines, tail...)
+			}
+			current = strings.TrimSpace(m[1])
+			found = found || current == section
+			lines = append(lines, line)
+			continue
+		}
+		if current == section {
+			if m := keyRe.FindStringSubmatch(line); m != nil {
+				for _, v := range values {
+					if v.Key == m[1] {
+						indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+						line = fmt.Sprintf("%s%s = %s", indent, v.Key, v.Value)
+						set[v.Key] = true
+						break
+					}
+				}
+			}
+		}
+		lines = append(lines, line)
+	}
+	if err = s.Err(); err != nil {
+		return fmt.Errorf("reading configuration: %s", err)
+	}
+	switch {
+	case current == section:
+		missing()
+	case !found:
+		if len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) != "" {
+			lines = append(lines, "")
+		}
+		lines = append(lines, fmt.Sprintf("[%s]", section))
+		missing()
+	}
+	for _, l := range lines {
+		if _, err = fmt.Fprintln(w, l); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func isBlankOrComment(line string) bool {
+	l := strings.TrimSpace(line)
+	return l == "" || strings.HasPrefix(l, "#")
+}
+
+// PatchFile sets the values in a section of the configuration file at pth
+func PatchFile(pth, section string, values []Value) (err error) {
+	info, err := os.Stat(pth)
+	if err != nil {
+		return
+	}
+	raw, err := os.ReadFile(pth)
+	if err != nil {
+		return
+	}
+	var out bytes.Buffer
+	if err = Patch(bytes.NewReader(raw), &out, section, values); err != nil {
+		return fmt.Errorf("patching %s: %s", pth, err)
+	}
+	return os.WriteFile(pth, out.Bytes(), info.Mode().Perm())
+}
@@ -0,0 +1,94 @@
+package tmconfig
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const sample = `# This is a TOML config file.
+proxy_app = "tcp://127.0.0.1:26658"
+
+#######################################################
+###         State Sync Configuration Options        ###
+#######################################################
+[statesync]
+# State sync rapidly bootstraps a new node
+enable = false
+
+# RPC servers (comma-separated) for light client verification
+rpc_servers = ""
+trust_height = 0
+trust_hash = ""
+trust_period = "168h0m0s"
+
+# Time to spend discovering snapshots before initiating a restore.
+discovery_time = "15s"
+
+#######################################################
+###       Fast Sync Configuration Connections       ###
+#######################################################
+[fastsync]
+version = "v0"
+`
+
+func TestPatch(t *testing.T) {
+	values := []Value{
+		Bool("enable", true),
+		String("rpc_servers", "http://a:26657,http://b:26657"),
+		Int("trust_height", 42),
+		String("trust_hash", "ABCD"),
+		String("trust_period", "336h0m0s"),
+		Int("chunk_fetchers", 4),
+	}
+	var out bytes.Buffer
+	assert.Nil(t, Patch(strings.NewReader(sample), &out, "statesync", values))
+	want := strings.NewReplacer(
+		"enable = false", "enable = true",
+		`rpc_servers = ""`, `rpc_servers = "http://a:26657,http://b:26657"`,
+		"trust_height = 0", "trust_height = 42",
+		`trust_hash = ""`, `trust_hash = "ABCD"`,
+		`trust_period = "168h0m0s"`, `trust_period = "336h0m0s"`,
+		`discovery_time = "15s"`+"\n", `discovery_time = "15s"`+"\nchunk_fetchers = 4\n",
+	).Replace(sample)
+	assert.Equal(t, want, out.String())
+
+	// patching again does not change the file
+	var again bytes.Buffer
+	assert.Nil(t, Patch(strings.NewReader(out.String()), &again, "statesync", values))
+	assert.Equal(t, out.String(), again.String())
+
+	// keys with the same name in other sections are left alone
+	out.Reset()
+	assert.Nil(t, Patch(strings.NewReader(sample), &out, "fastsync", []Value{String("version", "v2"), Bool("enable", true)}))
+	assert.Contains(t, out.String(), "enable = false\n")
+	assert.True(t, strings.HasSuffix(out.String(), "[fastsync]\nversion = \"v2\"\nenable = true\n"))
+
+	// missing sections are appended
+	out.Reset()
+	assert.Nil(t, Patch(strings.NewReader(sample), &out, "p2p", []Value{String("seeds", "id@host:26656")}))
+	assert.Equal(t, sample+"\n[p2p]\nseeds = \"id@host:26656\"\n", out.String())
+}
+
+func TestPatchFile(t *testing.T) {
+	pth := path.Join(t.TempDir(), "config.toml")
+	assert.Nil(t, os.WriteFile(pth, []byte(sample), 0640))
+	assert.Nil(t, PatchFile(pth, "statesync", []Value{Bool("enable", true)}))
+	raw, err := os.ReadFile(pth)
+	assert.Nil(t, err)
+	assert.Contains(t, string(raw), "\nenable = true\n")
+	info, err := os.Stat(pth)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+	assert.NotNil(t, PatchFile(path.Join(t.TempDir(), "missing.toml"), "statesync", nil))
+}
+
+func TestRender(t *testing.T) {
+	assert.Equal(t, "[statesync]\nenable = true\ntrust_height = 7\n",
+		Render("statesync", []Value{Bool("enable", true), Int("trust_height", 7)}))
+}
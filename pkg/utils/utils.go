@@ -16,7 +16,7 @@ func AbortCleanupIfError(err error, path string, message string, v ...interface{
 		fmt.Println("Cleaning up", path)
 		os.RemoveAll(path)
 	}
-	AbortIfError(err, message, v)
+	AbortIfError(err, message, v...)
 }
 
 // AbortIfError abort command if there is an error